@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/FraMan97/kairos/cli/config"
+	"github.com/spf13/cobra"
+)
+
+var cacheFileId string
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Commands to manage the local download cache",
+	Long:  `"Commands to manage the local download cache, where the chunks already fetched by an interrupted get are kept to be reused"`,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Command to clear the local download cache",
+	Long:  `"Command to remove the chunks kept in the local download cache. Use the --file-id argument to remove only the chunks of one file"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Println("Clearing the download cache...")
+		resp, err := config.Client.Post(fmt.Sprintf("http://localhost:%s/cache/clear?fileId=%s", strconv.Itoa(config.Port), cacheFileId),
+			"application/json",
+			nil)
+		if err != nil {
+			log.Println("Error calling cache clear endpoint: ", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == 200 {
+			log.Println("Download cache cleared!")
+		} else {
+			bodyBytes, err := io.ReadAll(resp.Body)
+			if err != nil {
+				log.Printf("Error clearing the download cache (status %d), but failed to read response body: %v\n", resp.StatusCode, err)
+				return
+			}
+			log.Printf("Error clearing the download cache (status %d): %s\n", resp.StatusCode, string(bodyBytes))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheClearCmd.Flags().StringVarP(&cacheFileId, "file-id", "f", "", "File id whose cached chunks are removed (all files if empty)")
+}
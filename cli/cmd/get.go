@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/FraMan97/kairos/cli/config"
@@ -12,6 +14,7 @@ import (
 )
 
 var fileId string
+var identityPath string
 
 var getCmd = &cobra.Command{
 	Use:   "get",
@@ -21,7 +24,21 @@ var getCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Printf("Getting file %s from the Kairos Network...", fileId)
 
-		resp, err := http.Get(fmt.Sprintf("http://localhost:%s/get?fileId=%s", strconv.Itoa(config.Port), fileId))
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/get?fileId=%s", strconv.Itoa(config.Port), fileId), nil)
+		if err != nil {
+			log.Println("Error creating get request: ", err)
+			return
+		}
+		if identityPath != "" {
+			identity, err := os.ReadFile(identityPath)
+			if err != nil {
+				log.Println("Error reading identity file: ", err)
+				return
+			}
+			req.Header.Set("X-Kairos-Identity", base64.StdEncoding.EncodeToString(identity))
+		}
+
+		resp, err := config.Client.Do(req)
 		if err != nil {
 			log.Println("Error calling get endpoint: ", err)
 			return
@@ -43,4 +60,5 @@ var getCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(getCmd)
 	getCmd.Flags().StringVarP(&fileId, "file-id", "f", "", "File id to identify the file")
+	getCmd.Flags().StringVar(&identityPath, "identity", "", "Path to the age identity file of a recipient, needed for files sealed to recipients")
 }
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/FraMan97/kairos/cli/config"
+	"github.com/spf13/cobra"
+)
+
+var keysExportPath string
+var keysImportPath string
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Commands to manage the identity key of the node",
+	Long: `"Commands to show, export, import and rotate the Ed25519 key that identifies the node in the Kairos Network. The key is kept across restarts,
+	a new key is announced to the Bootstrap Servers signed by both the old and the new key"`,
+}
+
+var keysShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Command to show the public key of the node and its fingerprint",
+	Run: func(cmd *cobra.Command, args []string) {
+		resp, err := config.Client.Get(fmt.Sprintf("http://localhost:%s/keys", strconv.Itoa(config.Port)))
+		if err != nil {
+			log.Println("Error calling keys endpoint: ", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			logKeysError("reading the node key", resp)
+			return
+		}
+		var key map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&key)
+		if err != nil {
+			log.Println("Error decoding the node key: ", err)
+			return
+		}
+		log.Printf("Fingerprint: %s\n", key["fingerprint"])
+		log.Printf("Public key (%s):\n%s", key["path"], key["publicKey"])
+	},
+}
+
+var keysExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Command to export the private key of the node to a file",
+	Long: `"Command to write the private key of the node, in PEM format, to the file given with --out. Anyone holding the file can act as the node:
+	keep it somewhere safe"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		resp, err := config.Client.Get(fmt.Sprintf("http://localhost:%s/keys/export", strconv.Itoa(config.Port)))
+		if err != nil {
+			log.Println("Error calling keys export endpoint: ", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			logKeysError("exporting the node key", resp)
+			return
+		}
+		privateKey, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Println("Error reading the exported key: ", err)
+			return
+		}
+		err = os.WriteFile(keysExportPath, privateKey, 0600)
+		if err != nil {
+			log.Println("Error writing the exported key: ", err)
+			return
+		}
+		log.Printf("Private key exported to %s\n", keysExportPath)
+	},
+}
+
+var keysImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Command to replace the key of the node with an imported private key",
+	Long: `"Command to make the node use the Ed25519 private key (PEM) given with --private-key. The change is announced to the Bootstrap Servers
+	like a rotation, the node must be started"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		privateKey, err := os.ReadFile(keysImportPath)
+		if err != nil {
+			log.Println("Error reading private key file: ", err)
+			return
+		}
+		postKeysChange("import", "application/x-pem-file", privateKey)
+	},
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Command to replace the key of the node with a new one",
+	Long: `"Command to generate a new key for the node. The rotation is announced to the Bootstrap Servers signed by the old and the new key,
+	so the files published with the old key stay owned by the node. The node must be started"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		postKeysChange("rotate", "application/json", nil)
+	},
+}
+
+func postKeysChange(action string, contentType string, body []byte) {
+	resp, err := config.Client.Post(fmt.Sprintf("http://localhost:%s/keys/%s", strconv.Itoa(config.Port), action), contentType, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error calling keys %s endpoint: %v\n", action, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		logKeysError("changing the node key", resp)
+		return
+	}
+	var key map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&key)
+	if err != nil {
+		log.Println("Error decoding the node key: ", err)
+		return
+	}
+	log.Printf("Node key changed, new fingerprint: %s\n", key["fingerprint"])
+}
+
+func logKeysError(action string, resp *http.Response) {
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error %s (status %d), but failed to read response body: %v\n", action, resp.StatusCode, err)
+		return
+	}
+	log.Printf("Error %s (status %d): %s\n", action, resp.StatusCode, string(bodyBytes))
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysShowCmd, keysExportCmd, keysImportCmd, keysRotateCmd)
+	keysExportCmd.Flags().StringVarP(&keysExportPath, "out", "o", "", "File where the private key is written")
+	keysExportCmd.MarkFlagRequired("out")
+	keysImportCmd.Flags().StringVar(&keysImportPath, "private-key", "", "Path to the Ed25519 private key (PEM) to import")
+	keysImportCmd.MarkFlagRequired("private-key")
+}
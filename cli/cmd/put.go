@@ -1,12 +1,12 @@
 package cmd
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
-	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -17,6 +17,12 @@ import (
 
 var filePath string
 var releaseTime string
+var resumeFileId string
+var abortFileId string
+var authorizedKeyPaths []string
+var recipients []string
+var earlyRelease bool
+var allowImmediate bool
 
 var putCmd = &cobra.Command{
 	Use:   "put",
@@ -24,6 +30,10 @@ var putCmd = &cobra.Command{
 	Long: `"Command to send a file to the network, specifying the --file-path argument (the local path where the file is located) 
 	and the --release-time argument (which indicates when the file will be made available)"`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if abortFileId != "" {
+			abortUpload(abortFileId)
+			return
+		}
 		log.Printf("Sending file %s ...\n", filePath)
 		file, err := os.Open(filePath)
 		if err != nil {
@@ -31,35 +41,35 @@ var putCmd = &cobra.Command{
 			return
 		}
 
-		body := &bytes.Buffer{}
-
-		writer := multipart.NewWriter(body)
+		defer file.Close()
 
-		part, err := writer.CreateFormFile("file", filepath.Base(filePath))
-		if err != nil {
-			log.Println("Error creating form file:", err)
-			return
+		endpoint := "put"
+		fields := map[string][]string{"release_time": {releaseTime}}
+		for _, keyPath := range authorizedKeyPaths {
+			key, err := os.ReadFile(keyPath)
+			if err != nil {
+				log.Println("Error reading authorized key: ", err)
+				return
+			}
+			fields["authorized_key"] = append(fields["authorized_key"], string(key))
 		}
-
-		_, err = io.Copy(part, file)
-		if err != nil {
-			log.Println("Error copying file content:", err)
-			return
+		fields["recipient"] = recipients
+		if earlyRelease {
+			fields["early_release"] = []string{"true"}
 		}
-
-		err = writer.WriteField("release_time", releaseTime)
-		if err != nil {
-			log.Println("Error writing release_time field:", err)
-			return
+		if allowImmediate {
+			fields["allow_immediate"] = []string{"true"}
 		}
-
-		err = writer.Close()
-		if err != nil {
-			log.Println("Error closing writer:", err)
-			return
+		if resumeFileId != "" {
+			log.Printf("Resuming upload of file %s ...\n", resumeFileId)
+			endpoint = "put/resume"
+			fields = map[string][]string{"file_id": {resumeFileId}}
 		}
-		resp, err := http.Post(fmt.Sprintf("http://localhost:%s/put", strconv.Itoa(config.Port)),
-			writer.FormDataContentType(),
+
+		body, contentType := multipartBody(file, fields)
+
+		resp, err := config.Client.Post(fmt.Sprintf("http://localhost:%s/%s", strconv.Itoa(config.Port), endpoint),
+			contentType,
 			body)
 		if err != nil {
 			log.Println("Error calling put endpoint: ", err)
@@ -68,12 +78,16 @@ var putCmd = &cobra.Command{
 		defer resp.Body.Close()
 		if resp.StatusCode == 200 {
 			log.Printf("File %s sent successfully to the Kairos Network!", filePath)
-			bodyBytes, err := io.ReadAll(resp.Body)
+			var response map[string]string
+			err := json.NewDecoder(resp.Body).Decode(&response)
 			if err != nil {
 				log.Printf("File put successfully in the Kairos Network (status %d), but failed to read response body: %v\n", resp.StatusCode, err)
 				return
 			}
-			log.Printf("File ID: %s\n", string(bodyBytes))
+			log.Printf("File ID: %s\n", response["fileId"])
+			if response["drandRound"] != "" {
+				log.Printf("Time-locked to Drand round %s, released at %s\n", response["drandRound"], response["roundTime"])
+			}
 		} else {
 			bodyBytes, err := io.ReadAll(resp.Body)
 			if err != nil {
@@ -85,9 +99,64 @@ var putCmd = &cobra.Command{
 	},
 }
 
+func abortUpload(fileId string) {
+	resp, err := config.Client.PostForm(fmt.Sprintf("http://localhost:%s/put/abort", strconv.Itoa(config.Port)), url.Values{"file_id": {fileId}})
+	if err != nil {
+		log.Println("Error calling put abort endpoint: ", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		log.Printf("Error aborting the upload (status %d): %s\n", resp.StatusCode, string(bodyBytes))
+		return
+	}
+	log.Printf("Upload of file %s aborted, its chunks and journal are deleted\n", fileId)
+}
+
+func multipartBody(file *os.File, fields map[string][]string) (io.Reader, string) {
+	body, pipeWriter := io.Pipe()
+
+	writer := multipart.NewWriter(pipeWriter)
+
+	go func() {
+		part, err := writer.CreateFormFile("file", filepath.Base(file.Name()))
+		if err != nil {
+			pipeWriter.CloseWithError(fmt.Errorf("error creating form file: %w", err))
+			return
+		}
+
+		_, err = io.Copy(part, file)
+		if err != nil {
+			pipeWriter.CloseWithError(fmt.Errorf("error copying file content: %w", err))
+			return
+		}
+
+		for name, values := range fields {
+			for _, value := range values {
+				err = writer.WriteField(name, value)
+				if err != nil {
+					pipeWriter.CloseWithError(fmt.Errorf("error writing %s field: %w", name, err))
+					return
+				}
+			}
+		}
+
+		pipeWriter.CloseWithError(writer.Close())
+	}()
+
+	return body, writer.FormDataContentType()
+}
+
 func init() {
 	rootCmd.AddCommand(putCmd)
 	putCmd.Flags().StringVarP(&filePath, "file-path", "f", "", "Path to the file to process")
 	putCmd.Flags().StringVarP(&releaseTime, "release-time", "r", "", "Time after publish file (i.e. 2025-12-01T15:00:00Z)")
+	putCmd.Flags().StringSliceVar(&authorizedKeyPaths, "authorized-key", nil, "Path to the public key (PEM) of a node allowed to download the chunks (repeat for many, everyone if empty)")
+	putCmd.Flags().StringSliceVar(&recipients, "recipient", nil, "Age public key (age1...) of a recipient able to decrypt the file after the release time (repeat for many)")
+	putCmd.Flags().BoolVar(&earlyRelease, "early-release", false, "Let the storage nodes serve the chunks before the release time (the file stays time-locked by Drand)")
+	putCmd.Flags().BoolVar(&allowImmediate, "allow-immediate", false, "Accept a release time in the past, the file is readable right after the upload")
+	putCmd.Flags().StringVar(&resumeFileId, "resume", "", "File id of an interrupted upload to resume (the --file-path must point to the same file)")
+	putCmd.Flags().StringVar(&abortFileId, "abort", "", "File id of an interrupted upload to drop: its chunks and its journal are deleted")
 
 }
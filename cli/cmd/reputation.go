@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/FraMan97/kairos/cli/config"
+	"github.com/spf13/cobra"
+)
+
+type nodeReputation struct {
+	Successes int     `json:"successes"`
+	Failures  int     `json:"failures"`
+	Score     float64 `json:"score"`
+}
+
+var reputationCmd = &cobra.Command{
+	Use:   "reputation",
+	Short: "Command to show the reputation of the nodes holding your chunks",
+	Long: `"Command to show the reputation score of the nodes holding the chunks of your files. The score is built from the proof-of-storage 
+	challenges the client sends to those nodes"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		resp, err := config.Client.Get(fmt.Sprintf("http://localhost:%s/reputation", strconv.Itoa(config.Port)))
+		if err != nil {
+			log.Println("Error calling reputation endpoint: ", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			bodyBytes, err := io.ReadAll(resp.Body)
+			if err != nil {
+				log.Printf("Error reading the node reputations (status %d), but failed to read response body: %v\n", resp.StatusCode, err)
+				return
+			}
+			log.Printf("Error reading the node reputations (status %d): %s\n", resp.StatusCode, string(bodyBytes))
+			return
+		}
+		var reputations map[string]nodeReputation
+		err = json.NewDecoder(resp.Body).Decode(&reputations)
+		if err != nil {
+			log.Println("Error decoding the node reputations: ", err)
+			return
+		}
+		if len(reputations) == 0 {
+			log.Println("No node challenged yet")
+			return
+		}
+		for node, reputation := range reputations {
+			log.Printf("%s - score %.2f (%d passed, %d failed)\n", node, reputation.Score, reputation.Successes, reputation.Failures)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reputationCmd)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/FraMan97/kairos/cli/config"
+	"github.com/spf13/cobra"
+)
+
+var revokeFileId string
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Command to revoke a file published by this node",
+	Long: `"Command to withdraw a file from the Kairos Network using the --file-id argument. The client sends a request signed with its key to a Bootstrap Server, 
+	which deletes the manifest and propagates the deletion to the other Bootstrap Servers, then asks the nodes holding the chunks to delete them"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Printf("Revoking file %s from the Kairos Network...", revokeFileId)
+
+		resp, err := config.Client.Post(fmt.Sprintf("http://localhost:%s/revoke?fileId=%s", strconv.Itoa(config.Port), revokeFileId),
+			"application/json",
+			nil)
+		if err != nil {
+			log.Println("Error calling revoke endpoint: ", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == 200 {
+			log.Printf("File %s revoked successfully!\n", revokeFileId)
+		} else {
+			bodyBytes, err := io.ReadAll(resp.Body)
+			if err != nil {
+				log.Printf("Error revoking file from the Kairos Network (status %d), but failed to read response body: %v\n", resp.StatusCode, err)
+				return
+			}
+			log.Printf("Error revoking file from the Kairos Network (status %d): %s\n", resp.StatusCode, string(bodyBytes))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(revokeCmd)
+	revokeCmd.Flags().StringVarP(&revokeFileId, "file-id", "f", "", "File id of the file to revoke")
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 
+	"github.com/FraMan97/kairos/cli/config"
 	"github.com/spf13/cobra"
 )
 
@@ -10,6 +11,9 @@ var rootCmd = &cobra.Command{
 	Use:   "src",
 	Short: "Cli used to manage client through commands",
 	Long:  "Cli used to manage client through commands",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return config.InitClient()
+	},
 }
 
 func Execute() {
@@ -20,6 +24,9 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().IntVar(&config.Port, "port", config.Port, "Port of the control API of the client")
+	rootCmd.PersistentFlags().StringVar(&config.Socket, "socket", "", "Unix socket of the control API of the client, instead of the port")
+	rootCmd.PersistentFlags().StringVar(&config.TokenFile, "token-file", "", "File holding the control token (default ~/.kairos/client/control_token)")
 
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
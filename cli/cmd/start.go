@@ -6,8 +6,6 @@ import (
 	"log"
 	"strconv"
 
-	"net/http"
-
 	"github.com/FraMan97/kairos/cli/config"
 	"github.com/spf13/cobra"
 )
@@ -18,7 +16,7 @@ var startCmd = &cobra.Command{
 	Long:  `"This command starts the node in the Kairos Network by initiating a Tor process, exposing a .onion address, and subscribing to a random Bootstrap Server"`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Println("Kairos Node starting...")
-		resp, err := http.Post(fmt.Sprintf("http://localhost:%s/start", strconv.Itoa(config.Port)),
+		resp, err := config.Client.Post(fmt.Sprintf("http://localhost:%s/start", strconv.Itoa(config.Port)),
 			"application/json",
 			nil)
 		if err != nil {
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// InitClient prepares the HTTP client for the control API of the node, authenticated
+// with the token the client writes on its first start.
+func InitClient() error {
+	if TokenFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		TokenFile = filepath.Join(home, ".kairos", "client", "control_token")
+	}
+	data, err := os.ReadFile(TokenFile)
+	if err != nil {
+		return fmt.Errorf("error reading the control token (start the client first): %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if Socket != "" {
+		// the URLs keep localhost as host, the connection goes to the socket
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", Socket)
+		}
+	}
+	Client = &http.Client{Transport: &tokenTransport{token: token, base: transport}}
+	return nil
+}
@@ -1,5 +1,10 @@
 package config
 
+import "net/http"
+
 var (
-	Port int = 8081
+	Port      int = 8082
+	Socket    string
+	TokenFile string
+	Client    *http.Client
 )
@@ -2,69 +2,203 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/FraMan97/kairos/client/internal/api"
+	"github.com/FraMan97/kairos/client/internal/bearer"
 	"github.com/FraMan97/kairos/client/internal/config"
-	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/crypto"
 	"github.com/FraMan97/kairos/client/internal/service"
+	"github.com/FraMan97/kairos/client/internal/timelock"
+	"github.com/FraMan97/kairos/client/internal/transport"
 )
 
 func main() {
-	bootstrapPtr := flag.String("bootstrap-servers", "", "bootstrap servers's .onion address (use the comma separator if many)")
-	noBootstrapPtr := flag.Bool("no-bootstrap-servers", false, "Start the bootstrap server without other bootstrap servers (standalone mode)")
-	flag.Parse()
-
-	if err := config.InitConfig(); err != nil {
+	cfg, err := config.InitConfig()
+	if err != nil {
 		log.Println("[Config] - Error initializing config: ", err)
 		os.Exit(1)
 	}
 
+	bootstrapPtr := flag.String("bootstrap-servers", "", "bootstrap servers's .onion address (use the comma separator if many)")
+	noBootstrapPtr := flag.Bool("no-bootstrap-servers", false, "Start the bootstrap server without other bootstrap servers (standalone mode)")
+	serveBeforeReleasePtr := flag.Bool("serve-before-release", false, "Serve the stored chunks before their release date (by default they are refused until the release)")
+	timeLockPtr := flag.String("timelock-backend", cfg.TimeLockBackend, "Time-lock backend: 'drand' for the public relays or 'local' for an in-process beacon (offline tests and demos, loopback transport only)")
+	drandRelaysPtr := flag.String("drand-relays", "", "Drand HTTP relays used for the time-lock (use the comma separator if many)")
+	drandChainHashPtr := flag.String("drand-chain-hash", "", "Hash of the Drand chain to time-lock on (e.g. quicknet), checked against the chain info of every relay")
+	noRepairPtr := flag.Bool("no-repair", false, "Do not run the background repair of the uploaded files")
+	heartbeatPtr := flag.Int("heartbeat-interval", cfg.CronHeartbeat, "Seconds between two subscription heartbeats to the bootstrap servers (jittered by 20%)")
+	maxInFlightBlocksPtr := flag.Int("max-in-flight-blocks", cfg.MaxInFlightBlocks, "Blocks of a file held in memory at once during an upload or a download")
+	passphraseFilePtr := flag.String("passphrase-file", "", "File holding the passphrase of the keystore (default: the "+crypto.PassphraseEnv+" environment variable)")
+	passphraseFdPtr := flag.Int("passphrase-fd", -1, "File descriptor to read the passphrase of the keystore from")
+	controlPortPtr := flag.Int("control-port", cfg.ControlPort, "Port of the control API used by the CLI, bound to 127.0.0.1")
+	controlSocketPtr := flag.String("control-socket", "", "Unix socket for the control API instead of the TCP port")
+	transportPtr := flag.String("transport", cfg.TransportBackend, "Transport between the nodes: 'tor' for onion services or 'loopback' for plain TCP (local tests, no anonymity)")
+	advertiseHostPtr := flag.String("advertise-host", cfg.AdvertiseHost, "Host the loopback transport listens on and advertises to the others")
+	portPtr := flag.Int("port", cfg.Port, "Port of the peer API")
+	flag.Parse()
+
 	if *bootstrapPtr != "" {
-		config.BootStrapServers = strings.Split(*bootstrapPtr, ",")
-		log.Println("[Config] - Bootstrap Servers set using flag: ", config.BootStrapServers)
+		cfg.BootStrapServers = strings.Split(*bootstrapPtr, ",")
+		log.Println("[Config] - Bootstrap Servers set using flag: ", cfg.BootStrapServers)
 	} else if *noBootstrapPtr {
-		config.BootStrapServers = []string{}
+		cfg.BootStrapServers = []string{}
 		log.Println("[Config] - Mode 'standalone' activated")
-	} else if len(config.BootStrapServers) == 0 {
+	} else if len(cfg.BootStrapServers) == 0 {
 		log.Println("[Config] - No Boostrap Servers set. Set using --bootstrap-servers flag")
 		os.Exit(1)
 	}
 
-	ctx, _ := context.WithCancel(context.Background())
-	_, err := database.OpenDatabase()
+	if *serveBeforeReleasePtr {
+		cfg.EnforceReleaseDate = false
+		log.Println("[Config] - Release date enforcement on stored chunks disabled")
+	}
+
+	if *drandRelaysPtr != "" {
+		cfg.DrandRelays = strings.Split(*drandRelaysPtr, ",")
+		log.Println("[Config] - Drand relays set using flag: ", cfg.DrandRelays)
+	}
+	if *drandChainHashPtr != "" {
+		if _, err := hex.DecodeString(*drandChainHashPtr); err != nil {
+			log.Println("[Config] - Invalid Drand chain hash: ", err)
+			os.Exit(1)
+		}
+		cfg.DrandChainHash = *drandChainHashPtr
+		log.Println("[Config] - Drand chain hash set using flag: ", cfg.DrandChainHash)
+	}
+
+	cfg.TimeLockBackend = *timeLockPtr
+	cfg.TransportBackend = *transportPtr
+	timeLock, err := timelock.NewProvider(cfg)
+	if err != nil {
+		log.Println("[Config] - Error selecting the time-lock backend: ", err)
+		os.Exit(1)
+	}
+	if cfg.TimeLockBackend == "local" {
+		log.Println("[Config] - Using the local beacon, files are NOT time-locked by the Drand network")
+	}
+
+	if *noRepairPtr {
+		cfg.RepairEnabled = false
+		log.Println("[Config] - Repair of the uploaded files disabled")
+	}
+
+	if *heartbeatPtr <= 0 {
+		log.Println("[Config] - The heartbeat interval must be positive")
+		os.Exit(1)
+	}
+	cfg.CronHeartbeat = *heartbeatPtr
+
+	if *maxInFlightBlocksPtr <= 0 {
+		log.Println("[Config] - The number of blocks in flight must be positive")
+		os.Exit(1)
+	}
+	cfg.MaxInFlightBlocks = *maxInFlightBlocksPtr
+
+	cfg.AdvertiseHost = *advertiseHostPtr
+	nodeTransport, err := transport.New(cfg)
+	if err != nil {
+		log.Println("[Config] - Error selecting the transport: ", err)
+		os.Exit(1)
+	}
+	if cfg.TransportBackend == "loopback" {
+		log.Println("[Config] - Using the loopback transport, the traffic does NOT go through Tor")
+	}
+	cfg.Port = *portPtr
+
+	cfg.ControlPort = *controlPortPtr
+	cfg.ControlSocket = *controlSocketPtr
+	if cfg.ControlSocket == "" && cfg.ControlPort == cfg.Port {
+		log.Println("[Config] - The control API can't share the port of the peer API")
+		os.Exit(1)
+	}
+
+	passphrase, err := crypto.ReadPassphrase(*passphraseFilePtr, *passphraseFdPtr)
 	if err != nil {
-		log.Println("[Main] - Error opening database: ", err)
+		log.Println("[Config] - Error reading the keystore passphrase: ", err)
 		os.Exit(1)
 	}
 
-	err = database.EnsureBucket(config.BoltDB, "chunks")
+	node, err := service.NewNode(cfg, nodeTransport, timeLock)
 	if err != nil {
-		log.Println("[Main] - Error creating bucket 'chunks': ", err)
+		log.Println("[Main] - Error opening the node: ", err)
 		os.Exit(1)
 	}
+	defer node.Close()
+	node.Keys.SetPassphrase(passphrase)
 
-	http.HandleFunc("/start", api.StartNode)
+	// the keystore is unlocked here, once, and /start only uses the key in memory
+	err = node.Keys.LoadOrCreateKeyPair()
+	if err != nil {
+		log.Println("[Main] - Error unlocking the key pair: ", err)
+		os.Exit(1)
+	}
 
-	http.HandleFunc("/put", api.PutFile)
+	token, err := bearer.LoadOrCreate(cfg.ControlTokenFile, "control")
+	if err != nil {
+		log.Println("[Main] - Error loading the control token: ", err)
+		os.Exit(1)
+	}
 
-	http.HandleFunc("/get", api.GetFile)
+	controller := api.NewController(node)
 
-	http.HandleFunc("/chunk", api.Chunk)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	go service.CleanOldRecords(ctx)
+	go node.CleanOldRecords(ctx)
 
-	log.Printf("[Main] - The Kairos node is listening to localhost:%s\n", strconv.Itoa(config.Port))
+	go node.ChallengeNodes(ctx)
+
+	go node.Heartbeat(ctx)
+
+	if cfg.RepairEnabled {
+		go node.RepairFiles(ctx)
+	}
 
-	err = http.ListenAndServe(fmt.Sprintf(":%s", strconv.Itoa(config.Port)), nil)
+	controlListener, err := controlListen(cfg)
+	if err != nil {
+		log.Println("[Main] - Error Listening on the control API: ", err)
+		os.Exit(1)
+	}
+	log.Printf("[Main] - The control API is listening to %s\n", controlListener.Addr())
+	go func() {
+		err := http.Serve(controlListener, bearer.Require(token, "control", controller.ControlRoutes()))
+		if err != nil {
+			log.Println("[Main] - Error Listening on the control API: ", err)
+			os.Exit(1)
+		}
+	}()
+
+	peerListener, err := nodeTransport.Listen(cfg.Port)
+	if err != nil {
+		log.Println("[Main] - Error Listening: ", err)
+		os.Exit(1)
+	}
+	log.Printf("[Main] - The Kairos node is listening to %s for the peers\n", peerListener.Addr())
+
+	err = http.Serve(peerListener, controller.PeerRoutes())
 	if err != nil {
 		log.Println("[Main] - Error Listening: ", err)
 		os.Exit(1)
 	}
 }
+
+func controlListen(cfg *config.Config) (net.Listener, error) {
+	if cfg.ControlSocket == "" {
+		return net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.ControlPort))
+	}
+	// a socket left by a previous run would make Listen fail
+	os.Remove(cfg.ControlSocket)
+	listener, err := net.Listen("unix", cfg.ControlSocket)
+	if err != nil {
+		return nil, err
+	}
+	return listener, os.Chmod(cfg.ControlSocket, 0600)
+}
@@ -5,9 +5,11 @@ go 1.24.0
 toolchain go1.24.10
 
 require (
-	github.com/FraMan97/kairos v0.0.0-20251201004542-9a4437437e62
+	filippo.io/age v1.1.1
 	github.com/boltdb/bolt v1.3.1
 	github.com/corvus-ch/shamir v1.0.1
+	github.com/drand/drand/v2 v2.0.2
+	github.com/drand/kyber v1.3.1
 	github.com/drand/tlock v1.2.0
 	github.com/google/uuid v1.6.0
 	github.com/klauspost/reedsolomon v1.12.6
@@ -15,13 +17,10 @@ require (
 )
 
 require (
-	filippo.io/age v1.1.1 // indirect
 	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
-	github.com/drand/drand/v2 v2.0.2 // indirect
 	github.com/drand/go-clients v0.2.0 // indirect
-	github.com/drand/kyber v1.3.1 // indirect
 	github.com/drand/kyber-bls12381 v0.3.1 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
@@ -1,21 +1,55 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/FraMan97/kairos/client/internal/service"
 )
 
-func Chunk(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost && r.Method != http.MethodGet {
-		log.Println("[Chunk] - Only POST and GET method allowed!")
-		http.Error(w, "Only POST and GET Methods allowed!", http.StatusMethodNotAllowed)
+func (c *Controller) ChunkChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[ChunkChallenge] - Only POST method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, err := c.node.AnswerChallenge(r)
+	if errors.Is(err, service.ErrChunkForbidden) {
+		log.Println("[ChunkChallenge] - Challenge refused: ", err)
+		http.Error(w, "Challenge refused", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, service.ErrChunkNotFound) {
+		log.Println("[ChunkChallenge] - Chunk not found: ", err)
+		http.Error(w, "Chunk not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("[ChunkChallenge] - Error answering the challenge: ", err)
+		http.Error(w, "Error answering the challenge", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (c *Controller) Chunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodDelete {
+		log.Println("[Chunk] - Only POST, GET, HEAD and DELETE method allowed!")
+		http.Error(w, "Only POST, GET, HEAD and DELETE Methods allowed!", http.StatusMethodNotAllowed)
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		err := service.SaveChunk(r)
+		err := c.node.SaveChunk(r)
+		if errors.Is(err, service.ErrChunkForbidden) {
+			log.Println("[Chunk] - Chunk overwrite refused: ", err)
+			http.Error(w, "Chunk overwrite refused", http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			log.Println("[Chunk] - Error saving chunk in DB: ", err)
 			http.Error(w, "Error saving chunk in DB", http.StatusInternalServerError)
@@ -24,12 +58,43 @@ func Chunk(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodGet {
-		chunk, err := service.GetChunk(r)
+		chunk, err := c.node.GetChunk(r)
+		if errors.Is(err, service.ErrChunkForbidden) {
+			log.Println("[Chunk] - Chunk access refused: ", err)
+			http.Error(w, "Chunk access refused", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, service.ErrChunkNotReleased) {
+			log.Println("[Chunk] - Chunk requested before its release date")
+			http.Error(w, "Chunk not released yet", http.StatusTooEarly)
+			return
+		}
 		if err != nil {
-			log.Println("[Chunk] - Error saving chunk: ", err)
-			http.Error(w, "Error saving chunk", http.StatusInternalServerError)
+			log.Println("[Chunk] - Error getting chunk: ", err)
+			http.Error(w, "Error getting chunk", http.StatusInternalServerError)
+			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(chunk)
 	}
+
+	if r.Method == http.MethodHead {
+		if !c.node.HasChunk(r) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		err := c.node.DeleteChunk(r)
+		if errors.Is(err, service.ErrChunkForbidden) {
+			log.Println("[Chunk] - Chunk deletion refused: ", err)
+			http.Error(w, "Chunk deletion refused", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			log.Println("[Chunk] - Error deleting chunk from DB: ", err)
+			http.Error(w, "Error deleting chunk from DB", http.StatusInternalServerError)
+			return
+		}
+	}
 }
@@ -1,43 +1,40 @@
 package api
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
-	"github.com/FraMan97/kairos/client/internal/config"
+	"filippo.io/age"
 	"github.com/FraMan97/kairos/client/internal/crypto"
 	"github.com/FraMan97/kairos/client/internal/models"
 	"github.com/FraMan97/kairos/client/internal/service"
 )
 
-func StartNode(w http.ResponseWriter, r *http.Request) {
+const identityHeader = "X-Kairos-Identity"
+
+func (c *Controller) StartNode(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		log.Println("[StartNode] - Only POST method allowed!")
 		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
 		return
 	}
 	log.Println("[StartNode] - Starting Kairos Node...")
-	_, err := service.StartTor()
-	if err != nil {
-		log.Println("[StartNode] - Starting error TOR: ", err)
-		http.Error(w, "Starting error TOR", http.StatusInternalServerError)
-		return
-	}
-
-	err = crypto.GenerateKeyPair()
+	_, err := c.node.StartTransport()
 	if err != nil {
-		log.Println("[StartNode] - Generation key pair error: ", err)
-		http.Error(w, "Error generation key pair", http.StatusInternalServerError)
+		log.Println("[StartNode] - Error starting the transport: ", err)
+		http.Error(w, "Error starting the transport", http.StatusInternalServerError)
 		return
 	}
 
-	err = service.SubscribeNode()
+	err = c.node.SubscribeNode()
 	if err != nil {
 		log.Println("[StartNode] - Error subscription Kairos node to BootstrapServer: ", err)
 		http.Error(w, "Error subcription Kairos node to BootstrapServer", http.StatusInternalServerError)
@@ -46,7 +43,7 @@ func StartNode(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func PutFile(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) PutFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		log.Println("[PutFile] - Only POST method allowed!")
 		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
@@ -55,7 +52,7 @@ func PutFile(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("[PutFile] - Putting file in the Kairos network...")
 
-	blockSize := config.TargetChunkSize * config.DataShards
+	blockSize := c.node.Config.TargetChunkSize * c.node.Config.DataShards
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -63,132 +60,220 @@ func PutFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Creation form file error", http.StatusInternalServerError)
 		return
 	}
+	defer file.Close()
 
 	releaseTime := r.FormValue("release_time")
-
-	defer file.Close()
-	results, blockSizes, err := service.SplitFile(file, blockSize, releaseTime)
+	round, roundTime, err := c.node.ValidateReleaseTime(releaseTime, r.FormValue("allow_immediate") == "true")
+	if errors.Is(err, service.ErrInvalidReleaseTime) {
+		log.Println("[PutFile] - Invalid release time: ", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Println("[PutFile] - Splitting file error: ", err)
-		http.Error(w, "Splitting file error", http.StatusInternalServerError)
+		log.Println("[PutFile] - Error resolving the Drand round: ", err)
+		http.Error(w, "Error resolving the Drand round", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[PutFile] - Release time %s maps to Drand round %d (%s)\n", releaseTime, round, roundTime.UTC().Format(time.RFC3339))
+
+	var options models.UploadOptions
+	for _, key := range r.MultipartForm.Value["authorized_key"] {
+		if err := crypto.ValidatePublicKey([]byte(key)); err != nil {
+			log.Println("[PutFile] - Invalid authorized key: ", err)
+			http.Error(w, "Invalid authorized key", http.StatusBadRequest)
+			return
+		}
+		options.AuthorizedKeys = append(options.AuthorizedKeys, []byte(key))
+	}
+	options.EarlyRelease = r.FormValue("early_release") == "true"
+	options.Recipients = r.MultipartForm.Value["recipient"]
+	if _, err := crypto.ParseRecipients(options.Recipients); err != nil {
+		log.Println("[PutFile] - Invalid recipient: ", err)
+		http.Error(w, "Invalid recipient", http.StatusBadRequest)
 		return
 	}
 
-	nodes, err := service.RequestNodesForFileUpload(len(results) * config.TotalShards)
+	blocks := service.CountBlocks(header.Size, blockSize)
+
+	nodes, err := c.node.RequestNodesForFileUpload(blocks * c.node.Config.TotalShards)
 	if err != nil {
 		log.Println("[PutFile] - Requiring nodes error: ", err)
 		http.Error(w, "Requiring nodes error", http.StatusInternalServerError)
 		return
 	}
 
-	fileManifest, err := service.GenerateFileManifest(results, blockSizes, nodes, file, header, releaseTime)
+	fileManifest, err := c.node.GenerateFileManifest(blocks, blockSize, nodes, file, header, releaseTime)
 	if err != nil {
 		log.Println("[PutFile] - Generating file manifest error: ", err)
 		http.Error(w, "Generating file manifest error", http.StatusInternalServerError)
 		return
 	}
 
-	err = service.UploadFileManifest(fileManifest)
+	fileManifest.Sealed = len(options.Recipients) > 0
+
+	placed, err := c.node.UploadFile(fileManifest, file, blockSize, options)
 	if err != nil {
-		log.Println("[PutFile] - Uploading file manifest error: ", err)
-		http.Error(w, "Uploading file manifest error", http.StatusInternalServerError)
+		log.Println("[PutFile] - Uploading file error: ", err)
+		if errors.Is(err, service.ErrUploadIncomplete) {
+			// the holders may be back later: the journal is kept for put --resume
+			http.Error(w, fmt.Sprintf("Upload incomplete, resume it with --resume=%s or drop it with --abort=%s", fileManifest.FileId, fileManifest.FileId), http.StatusServiceUnavailable)
+			return
+		}
+		c.node.RollbackUpload(fileManifest, placed)
+		c.node.DeleteUploadJournal(fileManifest.FileId)
+		http.Error(w, "Uploading file error", http.StatusInternalServerError)
 		return
 	}
 
-	err = service.UploadFile(fileManifest, results)
+	err = c.node.PublishFileManifest(fileManifest, placed)
 	if err != nil {
-		log.Println("[PutFile] - Uploading file error: ", err)
-		http.Error(w, "Uploading file error", http.StatusInternalServerError)
+		log.Println("[PutFile] - Uploading file manifest error (the upload can be resumed): ", err)
+		http.Error(w, "Uploading file manifest error", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	fmt.Fprintln(w, fileManifest.FileId)
+	writePutResponse(w, fileManifest.FileId, round, roundTime)
 }
 
-func GetFile(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		log.Println("[GetFile] - Only GET method allowed!")
+func (c *Controller) ResumePutFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[ResumePutFile] - Only POST method allowed!")
 		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
 		return
 	}
 
-	fileId := r.URL.Query().Get("fileId")
+	fileId := r.FormValue("file_id")
 	if fileId == "" {
-		log.Println("[GetFile] - Missing fileId query parameter")
-		http.Error(w, "Missing fileId query parameter", http.StatusBadRequest)
+		log.Println("[ResumePutFile] - Missing file_id field")
+		http.Error(w, "Missing file_id field", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[ResumePutFile] - Resuming upload of file %s in the Kairos network...\n", fileId)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		log.Println("[ResumePutFile] - Creation form file error: ", err)
+		http.Error(w, "Creation form file error", http.StatusInternalServerError)
 		return
 	}
+	defer file.Close()
 
-	fileManifest, err := service.GetFileManifestFromServer(fileId)
+	fileManifest, placed, err := c.node.ResumeUpload(fileId, file)
 	if err != nil {
-		log.Printf("Error retrieving file manifest from the Bootstrap Server: %v\n", err)
-		http.Error(w, "Error retrieving manifest", http.StatusInternalServerError)
+		log.Println("[ResumePutFile] - Resuming upload error: ", err)
+		http.Error(w, "Resuming upload error", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.node.PublishFileManifest(fileManifest, placed)
+	if err != nil {
+		log.Println("[ResumePutFile] - Uploading file manifest error: ", err)
+		http.Error(w, "Uploading file manifest error", http.StatusInternalServerError)
 		return
 	}
+	round, roundTime, err := c.node.GetRoundAndTimeForTime(fileManifest.ReleaseDate)
+	if err != nil {
+		log.Println("[ResumePutFile] - Error resolving the Drand round: ", err)
+	}
+	writePutResponse(w, fileManifest.FileId, round, roundTime)
+}
 
-	fileBlocks := make(map[int][]models.ChunkRequest)
-	shardsToRetrieve := fileManifest.ReedSolomonConfig.DataShards
+func (c *Controller) AbortPutFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[AbortPutFile] - Only POST method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
 
-	for blockIndex, blockData := range fileManifest.Split {
-		log.Printf("[GetFile] - Retrieving chunks for block %d...\n", blockIndex)
-		fileBlocks[blockIndex] = []models.ChunkRequest{}
-		shardsRetrieved := 0
+	fileId := r.FormValue("file_id")
+	if fileId == "" {
+		log.Println("[AbortPutFile] - Missing file_id field")
+		http.Error(w, "Missing file_id field", http.StatusBadRequest)
+		return
+	}
 
-		for _, chunkInfo := range blockData.Chunks {
-			if shardsRetrieved >= shardsToRetrieve {
-				break
-			}
+	err := c.node.AbortUpload(fileId)
+	if err != nil {
+		log.Println("[AbortPutFile] - Error aborting the upload: ", err)
+		http.Error(w, "Error aborting the upload", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[AbortPutFile] - Upload of file %s aborted\n", fileId)
+	w.WriteHeader(http.StatusOK)
+}
 
-			for _, node := range chunkInfo.Nodes {
-				chunk, err := service.RequestChunk(node, chunkInfo.ChunkId)
-				if err != nil {
-					continue
-				}
+func writePutResponse(w http.ResponseWriter, fileId string, round uint64, roundTime time.Time) {
+	response := map[string]string{"fileId": fileId}
+	if round != 0 {
+		response["drandRound"] = strconv.FormatUint(round, 10)
+		response["roundTime"] = roundTime.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-				fileBlocks[blockIndex] = append(fileBlocks[blockIndex], *chunk)
-				shardsRetrieved++
+func (c *Controller) GetFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Println("[GetFile] - Only GET method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
 
-				log.Printf("[GetFile] - Retrieved chunk %s (ShardIndex %d) for block %d from %s successfully\n", chunkInfo.ChunkId, chunkInfo.ShardIndex, blockIndex, node)
-				break
-			}
+	fileId := r.URL.Query().Get("fileId")
+	if fileId == "" {
+		log.Println("[GetFile] - Missing fileId query parameter")
+		http.Error(w, "Missing fileId query parameter", http.StatusBadRequest)
+		return
+	}
 
+	var identities []age.Identity
+	if identityFile := r.Header.Get(identityHeader); identityFile != "" {
+		decoded, err := base64.StdEncoding.DecodeString(identityFile)
+		if err == nil {
+			identities, err = crypto.ParseIdentities(decoded)
 		}
-
-		if shardsRetrieved < shardsToRetrieve {
-			log.Printf("[GetFile] - Error: Insufficient data for block %d. Required %d, got %d\n", blockIndex, shardsToRetrieve, shardsRetrieved)
-			http.Error(w, fmt.Sprintf("Insufficient data to reconstruct file (block %d)", blockIndex), http.StatusUnauthorized)
+		if err != nil {
+			log.Println("[GetFile] - Invalid identity file: ", err)
+			http.Error(w, "Invalid identity file", http.StatusBadRequest)
 			return
 		}
 	}
 
-	log.Println("[GetFile] - All necessary chunks retrieved. Starting local file reconstruction...")
-
-	savedFilePath, err := service.ReconstructAndSaveFileLocal(fileManifest, fileBlocks, config.FileGetDestDir)
+	fileManifest, err := c.node.GetFileManifestFromServer(fileId)
 	if err != nil {
-		log.Printf("[GetFile] - Error during file reconstruction: %v\n", err)
-		http.Error(w, "Error during file reconstruction", http.StatusInternalServerError)
+		log.Printf("Error retrieving file manifest from the Bootstrap Server: %v\n", err)
+		http.Error(w, "Error retrieving manifest", http.StatusInternalServerError)
 		return
 	}
 
-	file, err := os.Open(savedFilePath)
-	if err != nil {
-		log.Printf("[GetFile] - Error during opening the file: %v\n", err)
-		http.Error(w, "Error during file opening", http.StatusInternalServerError)
+	log.Println("[GetFile] - Retrieving chunks and reconstructing the file...")
+
+	savedFilePath, err := c.node.DownloadFile(fileManifest, c.node.Config.FileGetDestDir, identities)
+	if errors.Is(err, service.ErrIdentityRequired) || errors.Is(err, service.ErrNotRecipient) || errors.Is(err, service.ErrTimeLockChain) {
+		log.Printf("[GetFile] - Error: %v\n", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-	defer file.Close()
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		log.Printf("[GetFile] - Error during calculate the hash of the file: %v\n", err)
-		http.Error(w, "Error during file hash calculation", http.StatusInternalServerError)
+	if errors.Is(err, service.ErrInsufficientChunks) {
+		log.Printf("[GetFile] - Error: %v\n", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidFileName) {
+		log.Printf("[GetFile] - Error: %v\n", err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
-	hashFile := hex.EncodeToString(hasher.Sum(nil))
-	if hashFile != fileManifest.HashFile {
+	if errors.Is(err, service.ErrCorruptedFile) {
 		log.Printf("[GetFile] - The hash of the reconstructed file is diffrent from the original. Probably is corrupted")
 		http.Error(w, "The hash of the reconstructed file is diffrent from the original. Probably is corrupted", http.StatusInternalServerError)
 		return
 	}
+	if err != nil {
+		log.Printf("[GetFile] - Error during file reconstruction: %v\n", err)
+		http.Error(w, "Error during file reconstruction", http.StatusInternalServerError)
+		return
+	}
 	log.Printf("[GetFile] - File successfully reconstructed and saved to: %s\n", savedFilePath)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -199,3 +284,146 @@ func GetFile(w http.ResponseWriter, r *http.Request) {
 		"fileId":   fileId,
 	})
 }
+
+func (c *Controller) RevokeFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[RevokeFile] - Only POST method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileId := r.URL.Query().Get("fileId")
+	if fileId == "" {
+		log.Println("[RevokeFile] - Missing fileId query parameter")
+		http.Error(w, "Missing fileId query parameter", http.StatusBadRequest)
+		return
+	}
+
+	err := c.node.RevokeFile(fileId)
+	if err != nil {
+		log.Println("[RevokeFile] - Error revoking the file: ", err)
+		http.Error(w, "Error revoking the file", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RevokeFile] - File %s revoked\n", fileId)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) GetReputation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Println("[GetReputation] - Only GET method allowed!")
+		http.Error(w, "Only GET method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reputations, err := c.node.GetNodeReputations()
+	if err != nil {
+		log.Println("[GetReputation] - Error reading the node reputations: ", err)
+		http.Error(w, "Error reading the node reputations", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reputations)
+}
+
+func (c *Controller) ShowKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Println("[ShowKeys] - Only GET method allowed!")
+		http.Error(w, "Only GET method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"fingerprint": crypto.Fingerprint(c.node.Keys.PublicKey()),
+		"publicKey":   string(c.node.Keys.PublicKey()),
+		"path":        c.node.Config.PublicKeyDir,
+	})
+}
+
+func (c *Controller) ExportKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Println("[ExportKeys] - Only GET method allowed!")
+		http.Error(w, "Only GET method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Println("[ExportKeys] - Private key exported, fingerprint", crypto.Fingerprint(c.node.Keys.PublicKey()))
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(c.node.Keys.PrivateKey())
+}
+
+func (c *Controller) ImportKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[ImportKeys] - Only POST method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	privateKeyPEM, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		log.Println("[ImportKeys] - Error reading the private key: ", err)
+		http.Error(w, "Error reading the private key", http.StatusBadRequest)
+		return
+	}
+	privateKey, err := crypto.ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		log.Println("[ImportKeys] - Invalid private key: ", err)
+		http.Error(w, "Invalid private key", http.StatusBadRequest)
+		return
+	}
+	c.rotateKeys(w, "ImportKeys", privateKey)
+}
+
+func (c *Controller) RotateKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[RotateKeys] - Only POST method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	privateKey, err := service.GenerateKey()
+	if err != nil {
+		log.Println("[RotateKeys] - Error generating the new key: ", err)
+		http.Error(w, "Error generating the new key", http.StatusInternalServerError)
+		return
+	}
+	c.rotateKeys(w, "RotateKeys", privateKey)
+}
+
+// an imported key replaces the current one like a generated one, so both go through the
+// rotation announced to the bootstrap servers
+func (c *Controller) rotateKeys(w http.ResponseWriter, handler string, privateKey ed25519.PrivateKey) {
+	err := c.node.RotateKey(privateKey)
+	if errors.Is(err, service.ErrNodeNotStarted) {
+		log.Printf("[%s] - Error: %v\n", handler, err)
+		http.Error(w, "Start the node before changing its key", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[%s] - Error rotating the key: %v\n", handler, err)
+		http.Error(w, "Error rotating the key", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"fingerprint": crypto.Fingerprint(c.node.Keys.PublicKey())})
+}
+
+func (c *Controller) ClearCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		log.Println("[ClearCache] - Only POST method allowed!")
+		http.Error(w, "Only POST method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileId := r.URL.Query().Get("fileId")
+	err := c.node.ClearDownloadCache(fileId)
+	if err != nil {
+		log.Println("[ClearCache] - Error clearing the download cache: ", err)
+		http.Error(w, "Error clearing the download cache", http.StatusInternalServerError)
+		return
+	}
+	log.Println("[ClearCache] - Download cache cleared")
+	w.WriteHeader(http.StatusOK)
+}
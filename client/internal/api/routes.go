@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/FraMan97/kairos/client/internal/service"
+)
+
+type Controller struct {
+	node *service.Node
+}
+
+func NewController(node *service.Node) *Controller {
+	return &Controller{node: node}
+}
+
+// ControlRoutes drive the node and never go through the onion service.
+func (c *Controller) ControlRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/start", c.StartNode)
+
+	mux.HandleFunc("/put", c.PutFile)
+
+	mux.HandleFunc("/put/resume", c.ResumePutFile)
+
+	mux.HandleFunc("/put/abort", c.AbortPutFile)
+
+	mux.HandleFunc("/get", c.GetFile)
+
+	mux.HandleFunc("/revoke", c.RevokeFile)
+
+	mux.HandleFunc("/cache/clear", c.ClearCache)
+
+	mux.HandleFunc("/reputation", c.GetReputation)
+
+	mux.HandleFunc("/keys", c.ShowKeys)
+
+	mux.HandleFunc("/keys/export", c.ExportKeys)
+
+	mux.HandleFunc("/keys/import", c.ImportKeys)
+
+	mux.HandleFunc("/keys/rotate", c.RotateKeys)
+
+	return mux
+}
+
+// PeerRoutes are what the hidden service forwards to: only the chunk endpoints.
+func (c *Controller) PeerRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/chunk", c.Chunk)
+
+	mux.HandleFunc("/chunk/challenge", c.ChunkChallenge)
+
+	return mux
+}
@@ -0,0 +1,67 @@
+package bearer
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "control_token")
+	token, err := LoadOrCreate(path, "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 {
+		t.Fatalf("token %q is not 32 random bytes in hex", token)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("token file mode %v, want 0600", info.Mode().Perm())
+	}
+	again, err := LoadOrCreate(path, "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != token {
+		t.Fatal("the token changed on the second run")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		token         string
+		authorization string
+		want          int
+	}{
+		{"secret", "Bearer secret", http.StatusOK},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		Require(tt.token, "control", ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("token %q, header %q: status %d, want %d", tt.token, tt.authorization, w.Code, tt.want)
+		}
+	}
+}
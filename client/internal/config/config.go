@@ -1,54 +1,128 @@
 package config
 
 import (
-	"net/http"
 	"os"
 	"path/filepath"
-
-	"github.com/boltdb/bolt"
+	"time"
 )
 
-var (
-	OnionAddress string
-	HttpClient   *http.Client
-	PublicKey    []byte
-	PrivateKey   []byte
-	BoltDB       *bolt.DB
-
-	CronClean        int      = 3600
-	Port             int      = 8081
-	SocksPort        int      = 9050
-	BootStrapServers []string = []string{}
-	TargetChunkSize           = 500 * 1024
-	DataShards                = 3
-	ParityShards              = 2
-	TotalShards               = DataShards + ParityShards
-	ChunksTolerance           = 3
-	DatabaseService           = "BoltDB"
-
-	TorPath        string
-	TorDataDir     string
-	PrivateKeyDir  string
-	PublicKeyDir   string
-	FileGetDestDir string
-	DrandChainHash = "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
-	DrandRelays    = []string{"https://api.drand.sh", "https://drand.cloudflare.com"}
-)
+const DatabaseService = "BoltDB"
+
+// Config holds the settings of one node. Every node has its own, so several of them can
+// run in the same process.
+type Config struct {
+	CronClean           int
+	CronRepair          int
+	CronChallenge       int
+	CronHeartbeat       int
+	Port                int
+	ControlPort         int
+	SocksPort           int
+	BootStrapServers    []string
+	TargetChunkSize     int
+	DataShards          int
+	ParityShards        int
+	TotalShards         int
+	ChunksTolerance     int
+	MaxInFlightBlocks   int
+	FetchWorkers        int
+	FetchPerHostLimit   int
+	UploadWorkers       int
+	UploadRetries       int
+	UploadBackoff       time.Duration
+	MinReplicasPerShard int
+	ChunkRequestMaxSkew time.Duration
+	ReleaseSkew         time.Duration
+	EnforceReleaseDate  bool
+	MaxReleaseHorizon   time.Duration
+	RepairMargin        int
+	RepairEnabled       bool
+	ChallengeSamples    int
+	ChallengeSampleSize int
+	ChallengesPerRound  int
+	MaxPendingReports   int
+	UploadJournalTTL    time.Duration
+
+	TorPath            string
+	TorDataDir         string
+	DatabaseDir        string
+	PrivateKeyDir      string
+	PlainPrivateKeyDir string
+	PublicKeyDir       string
+	RetiredKeysDir     string
+	ControlSocket      string
+	ControlTokenFile   string
+	FileGetDestDir     string
+	TransportBackend   string
+	AdvertiseHost      string
+	TimeLockBackend    string
+	DrandChainHash     string
+	DrandRelays        []string
 
-func InitConfig() error {
+	DrandRelayCooldown time.Duration
+}
+
+func InitConfig() (*Config, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return New(home), nil
+}
 
+// New returns the default settings of a node keeping its state under home.
+func New(home string) *Config {
 	baseDir := filepath.Join(home, ".kairos", "client")
 
-	TorPath = filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor", "tor")
-	TorDataDir = filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor_data")
-	PrivateKeyDir = filepath.Join(baseDir, "keys", "private_key.pem")
-	PublicKeyDir = filepath.Join(baseDir, "keys", "public_key.pem")
+	cfg := &Config{
+		CronClean:           3600,
+		CronRepair:          1800,
+		CronChallenge:       900,
+		CronHeartbeat:       300,
+		Port:                8081,
+		ControlPort:         8082,
+		SocksPort:           9050,
+		BootStrapServers:    []string{},
+		TargetChunkSize:     500 * 1024,
+		DataShards:          3,
+		ParityShards:        2,
+		ChunksTolerance:     3,
+		MaxInFlightBlocks:   2,
+		FetchWorkers:        8,
+		FetchPerHostLimit:   2,
+		UploadWorkers:       8,
+		UploadRetries:       3,
+		UploadBackoff:       500 * time.Millisecond,
+		MinReplicasPerShard: 1,
+		ChunkRequestMaxSkew: 5 * time.Minute,
+		ReleaseSkew:         30 * time.Second,
+		EnforceReleaseDate:  true,
+		MaxReleaseHorizon:   5 * 365 * 24 * time.Hour,
+		RepairMargin:        1,
+		RepairEnabled:       true,
+		ChallengeSamples:    16,
+		ChallengeSampleSize: 4096,
+		ChallengesPerRound:  20,
+		MaxPendingReports:   200,
+		UploadJournalTTL:    7 * 24 * time.Hour,
 
-	FileGetDestDir = filepath.Join(home, "Downloads")
+		TorPath:            filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor", "tor"),
+		TorDataDir:         filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor_data"),
+		DatabaseDir:        filepath.Join(baseDir, "database"),
+		PrivateKeyDir:      filepath.Join(baseDir, "keys", "private_key.age"),
+		PlainPrivateKeyDir: filepath.Join(baseDir, "keys", "private_key.pem"),
+		PublicKeyDir:       filepath.Join(baseDir, "keys", "public_key.pem"),
+		RetiredKeysDir:     filepath.Join(baseDir, "keys", "retired"),
+		ControlTokenFile:   filepath.Join(baseDir, "control_token"),
+		FileGetDestDir:     filepath.Join(home, "Downloads"),
+		TransportBackend:   "tor",
+		AdvertiseHost:      "127.0.0.1",
+		TimeLockBackend:    "drand",
+		DrandChainHash:     "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971",
+		DrandRelays:        []string{"https://api.drand.sh", "https://drand.cloudflare.com"},
 
-	return nil
+		DrandRelayCooldown: 30 * time.Second,
+	}
+	cfg.TotalShards = cfg.DataShards + cfg.ParityShards
+	return cfg
 }
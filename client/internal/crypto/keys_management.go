@@ -1,87 +1,123 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-
-	"github.com/FraMan97/kairos/client/internal/config"
 )
 
-func GenerateKeyPair() error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("error finding user home directory: %w", err)
+// LoadOrCreateKeyPair unlocks the keystore, generating the key pair only on the first
+// run, so the identity of the node survives restarts.
+func (k *KeyStore) LoadOrCreateKeyPair() error {
+	privateKeyPEM, err := k.open()
+	if errors.Is(err, os.ErrNotExist) {
+		var privateKey ed25519.PrivateKey
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("error generating keys: %w", err)
+		}
+		err = k.WriteKeyPair(privateKey)
+		if err != nil {
+			return err
+		}
+		privateKeyPEM, err = EncodePrivateKey(privateKey)
+		if err != nil {
+			return err
+		}
+		log.Println("[Keys] - New key pair generated in", filepath.Dir(k.privateKeyDir))
+	} else if err != nil {
+		return err
+	} else {
+		log.Println("[Keys] - Key pair unlocked from", filepath.Dir(k.privateKeyDir))
 	}
-	keysDir := filepath.Join(home, ".kairos", "client", "keys")
 
-	os.MkdirAll(keysDir, 0700)
-
-	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	privateKey, err := ParsePrivateKey(privateKeyPEM)
 	if err != nil {
-		return fmt.Errorf("error generating keys: %w", err)
+		return err
 	}
-
-	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	// the public key is derived from the private one, rewrite it if it is missing or stale
+	publicKeyPEM, err := EncodePublicKey(privateKey.Public().(ed25519.PublicKey))
 	if err != nil {
-		return fmt.Errorf("error marshaling private key: %w", err)
+		return err
+	}
+	current, err := os.ReadFile(k.publicKeyDir)
+	if err != nil || !bytes.Equal(current, publicKeyPEM) {
+		err = os.WriteFile(k.publicKeyDir, publicKeyPEM, 0644)
+		if err != nil {
+			return fmt.Errorf("error saving public key: %w", err)
+		}
 	}
 
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "PRIVATE KEY",
-		Bytes: privateKeyBytes,
-	})
-
-	err = os.WriteFile(config.PrivateKeyDir, privateKeyPEM, 0600)
+	retired, err := k.openRetiredKeys()
 	if err != nil {
-		return fmt.Errorf("error saving private key: %w", err)
+		return err
 	}
+	k.setKeyPair(privateKey, privateKeyPEM, publicKeyPEM, retired)
+	log.Println("[Keys] - Node key fingerprint:", Fingerprint(publicKeyPEM))
+	return nil
+}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+func (k *KeyStore) WriteKeyPair(privateKey ed25519.PrivateKey) error {
+	err := os.MkdirAll(filepath.Dir(k.privateKeyDir), 0700)
 	if err != nil {
-		return fmt.Errorf("error marshaling public key: %w", err)
+		return fmt.Errorf("error creating keys directory: %w", err)
 	}
 
-	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: publicKeyBytes,
-	})
-
-	err = os.WriteFile(config.PublicKeyDir, publicKeyPEM, 0644)
+	privateKeyPEM, err := EncodePrivateKey(privateKey)
 	if err != nil {
-		return fmt.Errorf("error saving public key: %w", err)
+		return err
 	}
-
-	log.Println("[Tor] - Keys generated successfully!")
-	log.Println("[Tor] - Private key: private_key.pem")
-	log.Println("[Tor] - Public key: public_key.pem")
-
-	publicKey, err = GetPublicKey()
+	err = k.SealPrivateKey(privateKeyPEM, k.privateKeyDir)
 	if err != nil {
 		return err
 	}
-	config.PublicKey = publicKey
-	privateKey, err = GetPrivateKey()
+
+	publicKeyPEM, err := EncodePublicKey(privateKey.Public().(ed25519.PublicKey))
 	if err != nil {
 		return err
 	}
-	config.PrivateKey = privateKey
+	err = os.WriteFile(k.publicKeyDir, publicKeyPEM, 0644)
+	if err != nil {
+		return fmt.Errorf("error saving public key: %w", err)
+	}
 	return nil
 }
 
-func SignMessage(message []byte) ([]byte, error) {
-	privateKeyPEM, err := os.ReadFile(config.PrivateKeyDir)
+func EncodePrivateKey(privateKey ed25519.PrivateKey) ([]byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	}), nil
+}
+
+func EncodePublicKey(publicKey ed25519.PublicKey) ([]byte, error) {
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
-		return nil, fmt.Errorf("error reading private key: %w", err)
+		return nil, fmt.Errorf("error marshaling public key: %w", err)
 	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}), nil
+}
 
+func ParsePrivateKey(privateKeyPEM []byte) (ed25519.PrivateKey, error) {
 	block, _ := pem.Decode(privateKeyPEM)
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode PEM block")
@@ -96,28 +132,37 @@ func SignMessage(message []byte) ([]byte, error) {
 	if !ok {
 		return nil, fmt.Errorf("not an Ed25519 private key")
 	}
-
-	signature := ed25519.Sign(privateKey, message)
-
-	return signature, nil
+	return privateKey, nil
 }
 
-func GetPublicKey() ([]byte, error) {
-	publicKeyPEM, err := os.ReadFile(config.PublicKeyDir)
-	if err != nil {
-		return nil, fmt.Errorf("error reading public key: %w", err)
+// Fingerprint returns the SHA-256 of the DER public key, in the same form as OpenSSH.
+func Fingerprint(publicKeyPEM []byte) string {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return "invalid key"
 	}
+	sum := sha256.Sum256(block.Bytes)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
 
-	return publicKeyPEM, nil
+// PublisherTag is the short, URL-safe digest of a public key that a FileId carries, so a
+// downloader can tell which key is allowed to sign the manifest.
+func PublisherTag(publicKeyPEM []byte) string {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return ""
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:16])
 }
 
-func GetPrivateKey() ([]byte, error) {
-	privateKeyPEM, err := os.ReadFile(config.PrivateKeyDir)
+func (k *KeyStore) GetPublicKey() ([]byte, error) {
+	publicKeyPEM, err := os.ReadFile(k.publicKeyDir)
 	if err != nil {
-		return nil, fmt.Errorf("error reading private key: %w", err)
+		return nil, fmt.Errorf("error reading public key: %w", err)
 	}
 
-	return privateKeyPEM, nil
+	return publicKeyPEM, nil
 }
 
 func VerifySignature(message []byte, signature []byte, publicKey []byte) (bool, error) {
@@ -139,6 +184,32 @@ func VerifySignature(message []byte, signature []byte, publicKey []byte) (bool,
 	return ed25519.Verify(publicKey, message, signature), nil
 }
 
+func ValidatePublicKey(publicKey []byte) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return fmt.Errorf("failed to decode PEM block")
+	}
+
+	publicKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing public key: %w", err)
+	}
+
+	if _, ok := publicKeyInterface.(ed25519.PublicKey); !ok {
+		return fmt.Errorf("not an Ed25519 public key")
+	}
+	return nil
+}
+
+func SamePublicKey(a []byte, b []byte) bool {
+	blockA, _ := pem.Decode(a)
+	blockB, _ := pem.Decode(b)
+	if blockA == nil || blockB == nil {
+		return false
+	}
+	return bytes.Equal(blockA.Bytes, blockB.Bytes)
+}
+
 func GenerateRandomAESKey() []byte {
 	aesKey := make([]byte, 32)
 	rand.Read(aesKey)
@@ -153,6 +224,35 @@ func EncryptGCM(data, key []byte) ([]byte, error) {
 	return gcm.Seal(nonce, nonce, data, nil), nil
 }
 
+func EncryptGCMWithNonce(data, key, nonce []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("NewCipher error: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("NewGCM error: %v", err)
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size")
+	}
+	return gcm.Seal(append([]byte{}, nonce...), nonce, data, nil), nil
+}
+
+func NonceGCM(encrypted []byte) []byte {
+	block, _ := aes.NewCipher(make([]byte, 32))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	copy(nonce, encrypted)
+	return nonce
+}
+
+func EncryptedSizeGCM(plainSize int) int {
+	block, _ := aes.NewCipher(make([]byte, 32))
+	gcm, _ := cipher.NewGCM(block)
+	return gcm.NonceSize() + plainSize + gcm.Overhead()
+}
+
 func DecryptGCM(data, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -0,0 +1,342 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/FraMan97/kairos/client/internal/config"
+)
+
+const PassphraseEnv = "KAIROS_PASSPHRASE"
+
+var (
+	ErrNoPassphrase    = errors.New("no keystore passphrase, set it with " + PassphraseEnv + ", --passphrase-file or --passphrase-fd")
+	ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+)
+
+// KeyStore holds the key pair of a node. It is unlocked once: the passphrase and the
+// parsed key stay in memory and SignMessage never goes back to the disk.
+type KeyStore struct {
+	privateKeyDir      string
+	plainPrivateKeyDir string
+	publicKeyDir       string
+	retiredKeysDir     string
+
+	mu         sync.RWMutex
+	signingKey ed25519.PrivateKey
+	passphrase string
+	publicKey  []byte
+	privateKey []byte
+	retired    []retiredKey
+}
+
+// retiredKey is a key replaced by a rotation: the chunks it stored stay bound to it.
+type retiredKey struct {
+	signingKey ed25519.PrivateKey
+	publicKey  []byte
+}
+
+func NewKeyStore(cfg *config.Config) *KeyStore {
+	return &KeyStore{
+		privateKeyDir:      cfg.PrivateKeyDir,
+		plainPrivateKeyDir: cfg.PlainPrivateKeyDir,
+		publicKeyDir:       cfg.PublicKeyDir,
+		retiredKeysDir:     cfg.RetiredKeysDir,
+	}
+}
+
+// ReadPassphrase takes the keystore passphrase from the file descriptor fd, the file at
+// path or the KAIROS_PASSPHRASE environment variable, in this order.
+func ReadPassphrase(path string, fd int) (string, error) {
+	var data []byte
+	var err error
+	switch {
+	case fd >= 0:
+		file := os.NewFile(uintptr(fd), "passphrase")
+		if file == nil {
+			return "", fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		defer file.Close()
+		data, err = io.ReadAll(io.LimitReader(file, 4096))
+	case path != "":
+		data, err = os.ReadFile(path)
+	default:
+		data = []byte(os.Getenv(PassphraseEnv))
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading the passphrase: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", ErrNoPassphrase
+	}
+	return value, nil
+}
+
+func (k *KeyStore) SetPassphrase(value string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.passphrase = value
+}
+
+func (k *KeyStore) setKeyPair(privateKey ed25519.PrivateKey, privateKeyPEM []byte, publicKeyPEM []byte, retired []retiredKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.signingKey = privateKey
+	k.privateKey = privateKeyPEM
+	k.publicKey = publicKeyPEM
+	k.retired = retired
+}
+
+// PublicKey returns the PEM public key of the node, nil before the keystore is unlocked.
+func (k *KeyStore) PublicKey() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.publicKey
+}
+
+// PublicKeys returns the current public key followed by the retired ones, newest first.
+func (k *KeyStore) PublicKeys() [][]byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	publicKeys := [][]byte{k.publicKey}
+	for _, key := range k.retired {
+		publicKeys = append(publicKeys, key.publicKey)
+	}
+	return publicKeys
+}
+
+func (k *KeyStore) PrivateKey() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.privateKey
+}
+
+// SealPrivateKey writes the PEM private key to path encrypted with age (scrypt) under the
+// keystore passphrase.
+func (k *KeyStore) SealPrivateKey(privateKeyPEM []byte, path string) error {
+	sealed, err := k.seal(privateKeyPEM)
+	if err != nil {
+		return err
+	}
+	// a crash while writing must not leave a truncated keystore
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, sealed, 0600)
+	if err != nil {
+		return fmt.Errorf("error saving private key: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// SealNewPrivateKey is SealPrivateKey for a file that must not exist yet: it fails instead
+// of replacing a key already saved at path.
+func (k *KeyStore) SealNewPrivateKey(privateKeyPEM []byte, path string) error {
+	sealed, err := k.seal(privateKeyPEM)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, sealed, 0600)
+	if err != nil {
+		return fmt.Errorf("error saving private key: %w", err)
+	}
+	defer os.Remove(tmp)
+	// the link is both atomic and exclusive: it fails when path already exists
+	err = os.Link(tmp, path)
+	if err != nil {
+		return fmt.Errorf("error saving private key: %w", err)
+	}
+	return nil
+}
+
+func (k *KeyStore) seal(privateKeyPEM []byte) ([]byte, error) {
+	k.mu.RLock()
+	value := k.passphrase
+	k.mu.RUnlock()
+	if value == "" {
+		return nil, ErrNoPassphrase
+	}
+	recipient, err := age.NewScryptRecipient(value)
+	if err != nil {
+		return nil, err
+	}
+	var sealed bytes.Buffer
+	writer, err := age.Encrypt(&sealed, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(privateKeyPEM); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return sealed.Bytes(), nil
+}
+
+func (k *KeyStore) open() ([]byte, error) {
+	sealed, err := os.ReadFile(k.privateKeyDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return k.migratePlainKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key: %w", err)
+	}
+	return k.unseal(sealed)
+}
+
+func (k *KeyStore) unseal(sealed []byte) ([]byte, error) {
+	k.mu.RLock()
+	value := k.passphrase
+	k.mu.RUnlock()
+	if value == "" {
+		return nil, ErrNoPassphrase
+	}
+	identity, err := age.NewScryptIdentity(value)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(sealed), identity)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongPassphrase, err)
+	}
+	return io.ReadAll(reader)
+}
+
+// migratePlainKey moves the plaintext key written by the previous versions into the
+// encrypted keystore.
+func (k *KeyStore) migratePlainKey() ([]byte, error) {
+	privateKeyPEM, err := os.ReadFile(k.plainPrivateKeyDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParsePrivateKey(privateKeyPEM); err != nil {
+		return nil, err
+	}
+	err = k.SealPrivateKey(privateKeyPEM, k.privateKeyDir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Remove(k.plainPrivateKeyDir)
+	if err != nil {
+		return nil, fmt.Errorf("error removing the plaintext private key: %w", err)
+	}
+	log.Println("[Keys] - Plaintext private key moved to the encrypted keystore")
+	return privateKeyPEM, nil
+}
+
+// openRetiredKeys unlocks the keys left in the retired directory by the rotations,
+// newest first.
+func (k *KeyStore) openRetiredKeys() ([]retiredKey, error) {
+	paths, err := filepath.Glob(filepath.Join(k.retiredKeysDir, "*.age"))
+	if err != nil {
+		return nil, err
+	}
+	// the names carry the rotation time in nanoseconds
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	retired := make([]retiredKey, 0, len(paths))
+	for _, path := range paths {
+		sealed, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading retired key: %w", err)
+		}
+		privateKeyPEM, err := k.unseal(sealed)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := ParsePrivateKey(privateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		publicKeyPEM, err := EncodePublicKey(privateKey.Public().(ed25519.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		retired = append(retired, retiredKey{signingKey: privateKey, publicKey: publicKeyPEM})
+	}
+	return retired, nil
+}
+
+func (k *KeyStore) SignMessage(message []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.signingKey == nil {
+		return nil, fmt.Errorf("the key pair is not loaded")
+	}
+	return ed25519.Sign(k.signingKey, message), nil
+}
+
+// SignMessageAs signs with the current or the retired key matching publicKey.
+func (k *KeyStore) SignMessageAs(publicKey []byte, message []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.signingKey == nil {
+		return nil, fmt.Errorf("the key pair is not loaded")
+	}
+	if SamePublicKey(publicKey, k.publicKey) {
+		return ed25519.Sign(k.signingKey, message), nil
+	}
+	for _, key := range k.retired {
+		if SamePublicKey(publicKey, key.publicKey) {
+			return ed25519.Sign(key.signingKey, message), nil
+		}
+	}
+	return nil, fmt.Errorf("no key matches %s", Fingerprint(publicKey))
+}
+
+// SealLocal encrypts a secret the node keeps in its own database, like the block keys of
+// an unfinished upload, with a key derived from the node private key: a copy of the
+// database is not enough to read it.
+func (k *KeyStore) SealLocal(data []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.signingKey == nil {
+		return nil, fmt.Errorf("the key pair is not loaded")
+	}
+	key, err := localSealKey(k.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptGCM(data, key)
+}
+
+// OpenLocal decrypts a secret sealed by SealLocal with the current key or, when it was
+// sealed before a rotation, with a retired one.
+func (k *KeyStore) OpenLocal(sealed []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.signingKey == nil {
+		return nil, fmt.Errorf("the key pair is not loaded")
+	}
+	signingKeys := []ed25519.PrivateKey{k.signingKey}
+	for _, retired := range k.retired {
+		signingKeys = append(signingKeys, retired.signingKey)
+	}
+	for _, signingKey := range signingKeys {
+		key, err := localSealKey(signingKey)
+		if err != nil {
+			return nil, err
+		}
+		data, err := DecryptGCM(sealed, key)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("no key of the keystore opens the sealed data")
+}
+
+func localSealKey(signingKey ed25519.PrivateKey) ([]byte, error) {
+	return hkdf.Key(sha256.New, signingKey.Seed(), nil, "kairos local seal", 32)
+}
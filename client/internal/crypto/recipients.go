@@ -0,0 +1,52 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+func ParseRecipients(recipients []string) ([]age.Recipient, error) {
+	parsed := make([]age.Recipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+func ParseIdentities(identityFile []byte) ([]age.Identity, error) {
+	identities, err := age.ParseIdentities(bytes.NewReader(identityFile))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing identity file: %w", err)
+	}
+	return identities, nil
+}
+
+func WrapKey(key []byte, recipients []age.Recipient) ([]byte, error) {
+	var wrapped bytes.Buffer
+	w, err := age.Encrypt(&wrapped, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping key to recipients: %w", err)
+	}
+	if _, err := w.Write(key); err != nil {
+		return nil, fmt.Errorf("error wrapping key to recipients: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error wrapping key to recipients: %w", err)
+	}
+	return wrapped.Bytes(), nil
+}
+
+func UnwrapKey(wrapped []byte, identities []age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(wrapped), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
@@ -10,13 +11,8 @@ import (
 	"github.com/boltdb/bolt"
 )
 
-func OpenDatabase() (*bolt.DB, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-	dbDir := filepath.Join(home, ".kairos", "client", "database")
-	err = os.MkdirAll(dbDir, 0700)
+func OpenDatabase(dbDir string) (*bolt.DB, error) {
+	err := os.MkdirAll(dbDir, 0700)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +21,6 @@ func OpenDatabase() (*bolt.DB, error) {
 		return nil, err
 	}
 	log.Printf("[%s] - BoltDB opened in '%s'\n", config.DatabaseService, dbDir)
-	config.BoltDB = db
 	return db, err
 }
 
@@ -167,3 +162,48 @@ func GetAllKeys(db *bolt.DB, bucketName string) ([]string, error) {
 	log.Printf("[%s] - All keys from the bucket '%s' are extracted successfully from DB", config.DatabaseService, bucketName)
 	return values, nil
 }
+
+func GetDataWithPrefix(db *bolt.DB, bucketName string, prefix string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return fmt.Errorf("[%s] - bucket '%s' not found in DB", config.DatabaseService, bucketName)
+		}
+
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			valueCopy := make([]byte, len(v))
+			copy(valueCopy, v)
+
+			values[string(k)] = valueCopy
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[%s] - Data with prefix '%s' from the bucket '%s' are extracted successfully from DB", config.DatabaseService, prefix, bucketName)
+	return values, nil
+}
+
+func DeleteKeysWithPrefix(db *bolt.DB, bucketName string, prefix string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return fmt.Errorf("[%s] - bucket '%s' not found", config.DatabaseService, bucketName)
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Seek([]byte(prefix)) {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("[%s] - Deleted the keys with prefix '%s' in bucket '%s'\n", config.DatabaseService, prefix, bucketName)
+		return nil
+	})
+}
@@ -1,9 +1,12 @@
 package models
 
+import "encoding/json"
+
 type SubscriptionRequest struct {
 	Address   string `json:"address"`
 	PublicKey []byte `json:"public_key"`
 	Signature []byte `json:"signature"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 type FileManifestRequest struct {
@@ -29,25 +32,65 @@ type NodesForFileUploadRequest struct {
 }
 
 type ChunkRequest struct {
-	Address     string `json:"address"`
-	PublicKey   []byte `json:"public_key"`
-	Signature   []byte `json:"signature"`
-	ChunkId     string `json:"chunk_id"`
-	Shard       []byte `json:"shard"`
-	ReleaseDate string `json:"release_date"`
+	Address        string   `json:"address"`
+	PublicKey      []byte   `json:"public_key"`
+	Signature      []byte   `json:"signature"`
+	ChunkId        string   `json:"chunk_id"`
+	Shard          []byte   `json:"shard"`
+	KeyIndexPart   byte     `json:"key_index_part"`
+	KeyPart        []byte   `json:"key_part"`
+	ReleaseDate    string   `json:"release_date"`
+	AuthorizedKeys [][]byte `json:"authorized_keys,omitempty"`
+	EarlyRelease   bool     `json:"early_release,omitempty"`
+}
+
+type GetChunkRequest struct {
+	Address   string `json:"address"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+	ChunkId   string `json:"chunk_id"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type ManifestEnvelope struct {
+	Manifest   json.RawMessage `json:"manifest"`
+	PublicKey  []byte          `json:"public_key"`
+	Signature  []byte          `json:"signature"`
+	InsertedAt int64           `json:"inserted_at"`
+	// the rotations from the key the FileId is bound to up to PublicKey
+	Rotations []KeyRotationRequest `json:"rotations,omitempty"`
+}
+
+type RevokeFileManifestRequest struct {
+	Address   string `json:"address"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+	FileId    string `json:"file_id"`
+}
+
+type DeleteChunkRequest struct {
+	Address   string `json:"address"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+	ChunkId   string `json:"chunk_id"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 type FileManifest struct {
-	FileName          string            `json:"file_name"`
-	FileId            string            `json:"file_id"`
-	FileSize          int64             `json:"file_size"`
-	ReleaseDate       string            `json:"release_date"`
-	HashFile          string            `json:"hash_file"`
-	HashAlgorithm     string            `json:"hash_algorithm"`
+	FileName      string `json:"file_name"`
+	FileId        string `json:"file_id"`
+	Version       int64  `json:"version"`
+	FileSize      int64  `json:"file_size"`
+	ReleaseDate   string `json:"release_date"`
+	HashFile      string `json:"hash_file"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	// chain hash of the beacon the block keys are time-locked to
+	TimeLockChain     string            `json:"time_lock_chain"`
 	Blocks            int               `json:"blocks"`
 	ChunksPerBlocks   int               `json:"chunks_per_blocks"`
 	ReedSolomonConfig ReedSolomonConfig `json:"reed_solomon_config"`
 	Split             map[int]FileBlock `json:"split"`
+	Sealed            bool              `json:"sealed,omitempty"`
 }
 
 type ReedSolomonConfig struct {
@@ -61,9 +104,111 @@ type FileBlock struct {
 }
 
 type Chunk struct {
-	ChunkId      string   `json:"chunk_id"`
-	KeyIndexPart byte     `json:"key_index_part"`
-	KeyPart      []byte   `json:"key_part"`
-	ShardIndex   int      `json:"shard_index"`
-	Nodes        []string `json:"nodes"`
+	ChunkId    string   `json:"chunk_id"`
+	ShardIndex int      `json:"shard_index"`
+	Nodes      []string `json:"nodes"`
+}
+
+type EncodedBlock struct {
+	Index         int
+	EncryptedSize int
+	Shards        [][]byte
+	KeyIndexes    []byte
+	KeyParts      [][]byte
+	AESKey        []byte
+	Nonce         []byte
+}
+
+type FetchedBlock struct {
+	Index  int
+	Chunks []ChunkRequest
+}
+
+type UploadOptions struct {
+	AuthorizedKeys [][]byte `json:"authorized_keys"`
+	Recipients     []string `json:"recipients"`
+	EarlyRelease   bool     `json:"early_release"`
+}
+
+type UploadJournal struct {
+	Manifest  FileManifest  `json:"manifest"`
+	BlockSize int           `json:"block_size"`
+	Options   UploadOptions `json:"options"`
+	CreatedAt int64         `json:"created_at"`
+}
+
+type UploadJournalBlock struct {
+	Index int `json:"index"`
+	// the AES key of the block, sealed with the node key (KeyStore.SealLocal)
+	SealedKey  []byte   `json:"sealed_key"`
+	Nonce      []byte   `json:"nonce"`
+	KeyIndexes []byte   `json:"key_indexes"`
+	KeyParts   [][]byte `json:"key_parts"`
+	// SHA-256 of every shard, by shard index
+	ShardHashes [][]byte            `json:"shard_hashes"`
+	Acks        map[string][]string `json:"acks"`
+}
+
+type TrackedFile struct {
+	Manifest FileManifest         `json:"manifest"`
+	Options  UploadOptions        `json:"options"`
+	Blocks   map[int]TrackedBlock `json:"blocks"`
+}
+
+type TrackedBlock struct {
+	KeyIndexes  []byte   `json:"key_indexes"`
+	KeyParts    [][]byte `json:"key_parts"`
+	ShardHashes [][]byte `json:"shard_hashes"`
+}
+
+type ChunkChallengeRequest struct {
+	Address   string `json:"address"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+	ChunkId   string `json:"chunk_id"`
+	Nonce     []byte `json:"nonce"`
+	Offset    int    `json:"offset"`
+	Length    int    `json:"length"`
+}
+
+type ChunkChallengeResponse struct {
+	ChunkId string `json:"chunk_id"`
+	Proof   []byte `json:"proof"`
+}
+
+type StorageSample struct {
+	Nonce  []byte `json:"nonce"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Proof  []byte `json:"proof"`
+}
+
+type NodeReputation struct {
+	Successes     int     `json:"successes"`
+	Failures      int     `json:"failures"`
+	LastSuccess   int64   `json:"last_success"`
+	LastChallenge int64   `json:"last_challenge"`
+	Score         float64 `json:"score"`
+}
+
+type NodeReport struct {
+	Node      string `json:"node"`
+	Operation string `json:"operation"`
+	Success   bool   `json:"success"`
+}
+
+type NodeReportRequest struct {
+	Address   string       `json:"address"`
+	PublicKey []byte       `json:"public_key"`
+	Signature []byte       `json:"signature"`
+	Reports   []NodeReport `json:"reports"`
+}
+
+type KeyRotationRequest struct {
+	Address      string `json:"address"`
+	OldPublicKey []byte `json:"old_public_key"`
+	NewPublicKey []byte `json:"new_public_key"`
+	RotatedAt    int64  `json:"rotated_at"`
+	OldSignature []byte `json:"old_signature"`
+	NewSignature []byte `json:"new_signature"`
 }
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+type fetchScheduler struct {
+	perHost int
+	workers chan struct{}
+	mu      sync.Mutex
+	hosts   map[string]chan struct{}
+}
+
+type replicaResult struct {
+	chunk *models.ChunkRequest
+	node  string
+	err   error
+}
+
+type blockResult struct {
+	block models.FetchedBlock
+	err   error
+}
+
+type chunkResult struct {
+	chunk *models.ChunkRequest
+	info  models.Chunk
+	node  string
+	err   error
+}
+
+func (n *Node) newFetchScheduler() *fetchScheduler {
+	return &fetchScheduler{
+		perHost: n.Config.FetchPerHostLimit,
+		workers: make(chan struct{}, n.Config.FetchWorkers),
+		hosts:   make(map[string]chan struct{}),
+	}
+}
+
+func (s *fetchScheduler) acquire(ctx context.Context, node string) (func(), error) {
+	host, _, err := net.SplitHostPort(node)
+	if err != nil {
+		host = node
+	}
+	s.mu.Lock()
+	hostSlots, ok := s.hosts[host]
+	if !ok {
+		hostSlots = make(chan struct{}, s.perHost)
+		s.hosts[host] = hostSlots
+	}
+	s.mu.Unlock()
+
+	select {
+	case hostSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case s.workers <- struct{}{}:
+	case <-ctx.Done():
+		<-hostSlots
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-s.workers
+		<-hostSlots
+	}, nil
+}
+
+func (n *Node) FetchBlocks(ctx context.Context, fileManifest *models.FileManifest, blocks chan<- models.FetchedBlock) error {
+	defer close(blocks)
+	scheduler := n.newFetchScheduler()
+
+	pending := make(chan chan blockResult, n.Config.MaxInFlightBlocks) // blocks are fetched concurrently but delivered in order
+	go func() {
+		defer close(pending)
+		for i := 0; i < fileManifest.Blocks; i++ {
+			result := make(chan blockResult, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func(blockIndex int) {
+				chunks, err := n.fetchBlock(ctx, scheduler, fileManifest, blockIndex)
+				result <- blockResult{block: models.FetchedBlock{Index: blockIndex, Chunks: chunks}, err: err}
+			}(i)
+		}
+	}()
+
+	for result := range pending {
+		fetched := <-result
+		if fetched.err != nil {
+			return fetched.err
+		}
+		select {
+		case blocks <- fetched.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
+
+func (n *Node) fetchBlock(ctx context.Context, scheduler *fetchScheduler, fileManifest *models.FileManifest, blockIndex int) ([]models.ChunkRequest, error) {
+	log.Printf("[FileManagement] - Retrieving chunks for block %d...\n", blockIndex)
+	blockData, ok := fileManifest.Split[blockIndex]
+	if !ok {
+		return nil, fmt.Errorf("block %d missing from the file manifest", blockIndex)
+	}
+	shardsToRetrieve := fileManifest.ReedSolomonConfig.DataShards
+
+	blockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := []models.ChunkRequest{}
+	missing := []models.Chunk{}
+	for _, chunkInfo := range blockData.Chunks {
+		if chunk, ok := n.getCachedChunk(fileManifest.FileId, chunkInfo.ChunkId); ok {
+			chunks = append(chunks, *chunk)
+		} else {
+			missing = append(missing, chunkInfo)
+		}
+	}
+	if len(chunks) >= shardsToRetrieve {
+		log.Printf("[FileManagement] - Block %d found in the download cache\n", blockIndex)
+		return chunks, nil
+	}
+
+	results := make(chan chunkResult, len(missing))
+	for _, chunkInfo := range missing {
+		go func(chunkInfo models.Chunk) {
+			chunk, node, err := n.fetchChunk(blockCtx, scheduler, chunkInfo, nil)
+			results <- chunkResult{chunk: chunk, info: chunkInfo, node: node, err: err}
+		}(chunkInfo)
+	}
+
+	for range missing {
+		result := <-results
+		if result.err != nil {
+			continue
+		}
+		chunks = append(chunks, *result.chunk)
+		n.cacheChunk(fileManifest.FileId, result.chunk)
+		log.Printf("[FileManagement] - Retrieved chunk %s (ShardIndex %d) for block %d from %s successfully\n", result.info.ChunkId, result.info.ShardIndex, blockIndex, result.node)
+		if len(chunks) >= shardsToRetrieve {
+			return chunks, nil
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w (block %d): required %d, got %d", ErrInsufficientChunks, blockIndex, shardsToRetrieve, len(chunks))
+}
+
+// fetchChunk asks every holder of the chunk and returns the first valid answer. When
+// verify is set, an answer it refuses counts as a failure of the holder.
+func (n *Node) fetchChunk(ctx context.Context, scheduler *fetchScheduler, chunkInfo models.Chunk, verify func(*models.ChunkRequest) error) (*models.ChunkRequest, string, error) {
+	if len(chunkInfo.Nodes) == 0 {
+		return nil, "", fmt.Errorf("no nodes hold chunk %s", chunkInfo.ChunkId)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan replicaResult, len(chunkInfo.Nodes))
+	for _, node := range chunkInfo.Nodes {
+		go func(node string) {
+			release, err := scheduler.acquire(ctx, node)
+			if err != nil {
+				results <- replicaResult{node: node, err: err}
+				return
+			}
+			defer release()
+			chunk, err := n.RequestChunk(ctx, node, chunkInfo.ChunkId)
+			if err == nil && chunk.ChunkId != chunkInfo.ChunkId {
+				err = fmt.Errorf("node %s answered with chunk %s instead of %s", node, chunk.ChunkId, chunkInfo.ChunkId)
+			}
+			if err == nil && verify != nil {
+				err = verify(chunk)
+			}
+			results <- replicaResult{chunk: chunk, node: node, err: err}
+		}(node)
+	}
+
+	var lastErr error
+	for range chunkInfo.Nodes {
+		result := <-results
+		n.queueNodeReport(result.node, "download", result.err)
+		if result.err == nil {
+			return result.chunk, result.node, nil
+		}
+		lastErr = result.err
+	}
+	return nil, "", lastErr
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+// statusError is the answer of a node that refused a chunk.
+type statusError struct {
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.body)
+}
+
+type shardAck struct {
+	chunkId string
+	node    string
+	err     error
+}
+
+func (n *Node) uploadBlock(ctx context.Context, fileManifest *models.FileManifest, encodedBlock models.EncodedBlock, options models.UploadOptions, acked map[string][]string) (map[string][]string, error) {
+	block, ok := fileManifest.Split[encodedBlock.Index]
+	if !ok || block.EncryptedBlockSize != encodedBlock.EncryptedSize {
+		return nil, fmt.Errorf("block %d does not match the file manifest", encodedBlock.Index)
+	}
+
+	// every payload is signed before the first send: an error later would leave the
+	// senders blocked on acks
+	payloads := make(map[string][]byte, len(block.Chunks))
+	for _, chunk := range block.Chunks {
+		payload, err := n.buildChunkRequest(fileManifest, chunk, encodedBlock, options)
+		if err != nil {
+			return nil, err
+		}
+		payloads[chunk.ChunkId] = payload
+	}
+
+	workers := make(chan struct{}, n.Config.UploadWorkers)
+	acks := make(chan shardAck)
+	var wg sync.WaitGroup
+	for _, chunk := range block.Chunks {
+		payload := payloads[chunk.ChunkId]
+		for _, node := range chunk.Nodes {
+			if slices.Contains(acked[chunk.ChunkId], node) {
+				continue
+			}
+			wg.Add(1)
+			go func(chunkId string, node string) {
+				defer wg.Done()
+				select {
+				case workers <- struct{}{}:
+				case <-ctx.Done():
+					acks <- shardAck{chunkId: chunkId, node: node, err: ctx.Err()}
+					return
+				}
+				err := n.postChunkWithRetry(ctx, node, payload)
+				<-workers
+				acks <- shardAck{chunkId: chunkId, node: node, err: err}
+			}(chunk.ChunkId, node)
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(acks)
+	}()
+
+	confirmed := make(map[string][]string)
+	for chunkId, nodes := range acked {
+		confirmed[chunkId] = append([]string{}, nodes...)
+	}
+	for ack := range acks {
+		n.queueNodeReport(ack.node, "upload", ack.err)
+		if ack.err != nil {
+			log.Printf("[FileManagement] - Chunk %s not stored on %s: %v\n", ack.chunkId, ack.node, ack.err)
+			continue
+		}
+		confirmed[ack.chunkId] = append(confirmed[ack.chunkId], ack.node)
+	}
+
+	storedShards := 0
+	for _, chunk := range block.Chunks {
+		replicas := len(confirmed[chunk.ChunkId])
+		if replicas >= n.Config.MinReplicasPerShard {
+			storedShards++
+		} else {
+			log.Printf("[FileManagement] - Chunk %s of block %d reached %d replicas, required %d\n", chunk.ChunkId, encodedBlock.Index, replicas, n.Config.MinReplicasPerShard)
+		}
+	}
+	if storedShards < fileManifest.ReedSolomonConfig.DataShards {
+		return confirmed, fmt.Errorf("%w: block %d could not be sent, %d shards stored, required %d", ErrUploadIncomplete, encodedBlock.Index, storedShards, fileManifest.ReedSolomonConfig.DataShards)
+	}
+	log.Printf("[FileManagement] - Block %d stored: %d/%d shards durably placed\n", encodedBlock.Index, storedShards, len(block.Chunks))
+	return confirmed, nil
+}
+
+func (n *Node) buildChunkRequest(fileManifest *models.FileManifest, chunk models.Chunk, encodedBlock models.EncodedBlock, options models.UploadOptions) ([]byte, error) {
+	chunkRequest := models.ChunkRequest{
+		Address:        n.Address(),
+		PublicKey:      n.Keys.PublicKey(),
+		ChunkId:        chunk.ChunkId,
+		Shard:          encodedBlock.Shards[chunk.ShardIndex],
+		KeyIndexPart:   encodedBlock.KeyIndexes[chunk.ShardIndex],
+		KeyPart:        encodedBlock.KeyParts[chunk.ShardIndex],
+		ReleaseDate:    fileManifest.ReleaseDate,
+		AuthorizedKeys: options.AuthorizedKeys,
+		EarlyRelease:   options.EarlyRelease,
+	}
+	jsonBytes, err := json.Marshal(chunkRequest)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := n.Keys.SignMessage(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
+	chunkRequest.Signature = signature
+	return json.Marshal(chunkRequest)
+}
+
+func (n *Node) postChunkWithRetry(ctx context.Context, node string, payload []byte) error {
+	var err error
+	backoff := n.Config.UploadBackoff
+	for attempt := 0; attempt <= n.Config.UploadRetries; attempt++ {
+		if attempt > 0 {
+			jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+			select {
+			case <-time.After(backoff + jitter):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		err = n.postChunk(ctx, node, payload)
+		if err == nil {
+			return nil
+		}
+		// a 4xx answer will not change on the next attempt
+		var refused *statusError
+		if errors.As(err, &refused) && refused.status < http.StatusInternalServerError {
+			return err
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", n.Config.UploadRetries+1, err)
+}
+
+func (n *Node) postChunk(ctx context.Context, node string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/chunk", node), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &statusError{status: resp.StatusCode, body: string(body)}
+	}
+	return nil
+}
+
+func (n *Node) RollbackUpload(fileManifest *models.FileManifest, placed map[string][]string) {
+	log.Printf("[FileManagement] - Deleting the chunks of file %s from the nodes...\n", fileManifest.FileId)
+	err := n.deleteStorageSamples(fileManifest.FileId)
+	if err != nil {
+		log.Printf("[FileManagement] - Error deleting the storage samples of file %s: %v\n", fileManifest.FileId, err)
+	}
+	workers := make(chan struct{}, n.Config.UploadWorkers)
+	var wg sync.WaitGroup
+	for chunkId, nodes := range placed {
+		for _, node := range nodes {
+			wg.Add(1)
+			workers <- struct{}{}
+			go func(chunkId string, node string) {
+				defer wg.Done()
+				defer func() { <-workers }()
+				err := n.requestChunkDeletion(node, chunkId)
+				if err != nil {
+					log.Printf("[FileManagement] - Error deleting chunk %s from %s: %v\n", chunkId, node, err)
+				}
+			}(chunkId, node)
+		}
+	}
+	wg.Wait()
+}
+
+func (n *Node) requestChunkDeletion(node string, chunkId string) error {
+	return n.asOwner(func(publicKey []byte) error {
+		return n.requestChunkDeletionAs(node, chunkId, publicKey)
+	})
+}
+
+func (n *Node) requestChunkDeletionAs(node string, chunkId string, publicKey []byte) error {
+	deleteRequest := models.DeleteChunkRequest{Address: n.Address(), PublicKey: publicKey, ChunkId: chunkId, Timestamp: time.Now().UnixNano()}
+	jsonBytes, err := json.Marshal(deleteRequest)
+	if err != nil {
+		return err
+	}
+	signature, err := n.Keys.SignMessageAs(publicKey, jsonBytes)
+	if err != nil {
+		return err
+	}
+	deleteRequest.Signature = signature
+	jsonBytes, err = json.Marshal(deleteRequest)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/chunk", node), bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", ErrChunkForbidden, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/config"
+)
+
+func TestPostChunkWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int32
+	}{
+		{"stored", http.StatusOK, 1},
+		{"refused", http.StatusForbidden, 1},
+		{"invalid", http.StatusUnprocessableEntity, 1},
+		{"unavailable", http.StatusServiceUnavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			cfg := config.New(t.TempDir())
+			cfg.UploadRetries = 2
+			cfg.UploadBackoff = time.Millisecond
+			n := &Node{Config: cfg, httpClient: srv.Client()}
+			err := n.postChunkWithRetry(context.Background(), strings.TrimPrefix(srv.URL, "http://"), []byte("{}"))
+			if got := attempts.Load(); got != tt.attempts {
+				t.Fatalf("%d attempts, want %d", got, tt.attempts)
+			}
+			var refused *statusError
+			if tt.status != http.StatusOK && (!errors.As(err, &refused) || refused.status != tt.status) {
+				t.Fatalf("error %v does not carry status %d", err, tt.status)
+			}
+		})
+	}
+}
@@ -8,19 +8,18 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/FraMan97/kairos/client/internal/config"
 	"github.com/FraMan97/kairos/client/internal/database"
 	"github.com/FraMan97/kairos/client/internal/models"
 )
 
-func CleanOldRecords(ctx context.Context) {
-	ticker := time.NewTicker(getDelay(config.CronClean))
+func (n *Node) CleanOldRecords(ctx context.Context) {
+	ticker := time.NewTicker(getDelay(n.Config.CronClean))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			clean()
+			n.clean()
 
 		case <-ctx.Done():
 			log.Println("[Sync] - Context cancelled, stopping ticker")
@@ -29,8 +28,10 @@ func CleanOldRecords(ctx context.Context) {
 	}
 }
 
-func clean() {
-	allChunksData, err := database.GetAllData(config.BoltDB, "chunks")
+func (n *Node) clean() {
+	n.cleanUploadJournals()
+
+	allChunksData, err := database.GetAllData(n.DB, "chunks")
 	if err != nil {
 		log.Println("[Clean] - Error: ", err)
 		return
@@ -48,7 +49,7 @@ func clean() {
 		oneWeekLater := parsedTime.Add(time.Hour * 24 * 7) // clean old chunks after 1 week
 		now = time.Now().UTC()
 		if now.After(oneWeekLater) {
-			err = database.DeleteKey(config.BoltDB, "chunks", chunk.ChunkId)
+			err = database.DeleteKey(n.DB, "chunks", chunk.ChunkId)
 			if err != nil {
 				log.Println("[Clean] - Error: ", err)
 			}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+func (n *Node) getCachedChunk(fileId string, chunkId string) (*models.ChunkRequest, bool) {
+	data, err := database.GetData(n.DB, "downloads", downloadCacheKey(fileId, chunkId))
+	if err != nil {
+		return nil, false
+	}
+	var chunk models.ChunkRequest
+	err = json.Unmarshal(data, &chunk)
+	if err != nil || chunk.ChunkId != chunkId {
+		return nil, false
+	}
+	return &chunk, true
+}
+
+func (n *Node) cacheChunk(fileId string, chunk *models.ChunkRequest) {
+	payload, err := json.Marshal(chunk)
+	if err != nil {
+		log.Printf("[DownloadCache] - Error caching chunk %s: %v\n", chunk.ChunkId, err)
+		return
+	}
+	err = database.PutData(n.DB, "downloads", downloadCacheKey(fileId, chunk.ChunkId), payload)
+	if err != nil {
+		log.Printf("[DownloadCache] - Error caching chunk %s: %v\n", chunk.ChunkId, err)
+	}
+}
+
+func (n *Node) ClearDownloadCache(fileId string) error {
+	prefix := ""
+	if fileId != "" {
+		prefix = fileId + "/"
+	}
+	return database.DeleteKeysWithPrefix(n.DB, "downloads", prefix)
+}
+
+func downloadCacheKey(fileId string, chunkId string) string {
+	return fileId + "/" + chunkId
+}
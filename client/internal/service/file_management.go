@@ -2,9 +2,12 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,141 +16,284 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/FraMan97/kairos/client/internal/config"
+	"filippo.io/age"
 	"github.com/FraMan97/kairos/client/internal/crypto"
 	"github.com/FraMan97/kairos/client/internal/database"
 	"github.com/FraMan97/kairos/client/internal/models"
+	"github.com/FraMan97/kairos/client/internal/timelock"
 	"github.com/corvus-ch/shamir"
 	"github.com/google/uuid"
 	"github.com/klauspost/reedsolomon"
 
 	"github.com/drand/tlock"
-	tlock_http "github.com/drand/tlock/networks/http"
 )
 
-func SplitFile(file multipart.File, blockSize int, releaseTime string) (map[int]map[string][][]byte, map[int]int, error) {
-	drandRound, err := GetRoundForTime(releaseTime)
-	if err != nil {
-		return nil, nil, err
-	}
-	log.Printf("[Drand] - Encryption Time-Lock for the round: %d\n", drandRound)
+const chunkAuthHeader = "X-Kairos-Chunk-Request"
+
+var (
+	ErrChunkForbidden     = errors.New("access to the chunk not allowed")
+	ErrChunkNotReleased   = errors.New("the chunk is not released yet")
+	ErrInsufficientChunks = errors.New("insufficient data to reconstruct file")
+	ErrCorruptedFile      = errors.New("the hash of the reconstructed file is different from the original, probably it is corrupted")
+	ErrIdentityRequired   = errors.New("the file is sealed to recipients, an identity is required")
+	ErrNotRecipient       = errors.New("none of the identities is a recipient of the file")
+	ErrInvalidReleaseTime = errors.New("invalid release time")
+	ErrUploadIncomplete   = errors.New("not enough shards stored")
+	ErrTimeLockChain      = errors.New("the file is time-locked on another chain")
+	ErrInvalidFileName    = errors.New("the manifest has no usable file name")
+)
+
+func (n *Node) SplitFile(ctx context.Context, file io.Reader, blockSize int, releaseTime string, recipients []string, journal map[int]models.UploadJournalBlock, blocks chan<- models.EncodedBlock) error {
+	defer close(blocks)
 
-	tNetwork, err := tlock_http.NewNetwork(config.DrandRelays[rand.Intn(len(config.DrandRelays))], config.DrandChainHash)
+	var tlockClient tlock.Tlock
+	var drandRound uint64
+	tlockReady := false
+
+	ageRecipients, err := crypto.ParseRecipients(recipients)
 	if err != nil {
-		return nil, nil, fmt.Errorf("errore network tlock: %v", err)
+		return err
 	}
-	tlockClient := tlock.New(tNetwork)
 
-	enc, _ := reedsolomon.New(config.DataShards, config.ParityShards)
+	enc, _ := reedsolomon.New(n.Config.DataShards, n.Config.ParityShards)
 
 	buffer := make([]byte, blockSize)
 	blockID := 0
-	results := make(map[int]map[string][][]byte)
-	blockSizes := make(map[int]int)
 
 	for {
-		n, err := io.ReadFull(file, buffer)
+		read, err := io.ReadFull(file, buffer)
 		if err == io.EOF {
 			break
 		}
 		if err == io.ErrUnexpectedEOF {
-			buffer = buffer[:n]
 			err = nil
 		} else if err != nil {
-			return nil, nil, err
+			return err
 		}
 
-		key := crypto.GenerateRandomAESKey()
+		var block models.EncodedBlock
+		if journaled, ok := journal[blockID]; ok {
+			block, err = n.encodeJournaledBlock(enc, buffer[:read], journaled)
+			if err != nil {
+				return err
+			}
+		} else {
+			if !tlockReady {
+				drandRound, err = n.GetRoundForTime(releaseTime)
+				if err != nil {
+					return err
+				}
+				log.Printf("[Drand] - Encryption Time-Lock for the round: %d\n", drandRound)
 
-		var encryptedKeyBuf bytes.Buffer
-		err = tlockClient.Encrypt(&encryptedKeyBuf, bytes.NewReader(key), drandRound)
-		if err != nil {
-			return nil, nil, err
-		}
-		encryptedKey := encryptedKeyBuf.Bytes()
+				tNetwork, err := n.timeLockNetwork()
+				if err != nil {
+					return fmt.Errorf("errore network tlock: %v", err)
+				}
+				tlockClient = tlock.New(tNetwork)
+				tlockReady = true
+			}
 
-		encryptedBlock, err := crypto.EncryptGCM(buffer, key)
-		if err != nil {
-			return nil, nil, err
-		}
+			key := crypto.GenerateRandomAESKey()
 
-		blockSizes[blockID] = len(encryptedBlock)
+			// the key is sealed to the recipients first and then to the round,
+			// so both the beacon and a recipient identity are needed to open it
+			lockedKey := key
+			if len(ageRecipients) > 0 {
+				lockedKey, err = crypto.WrapKey(key, ageRecipients)
+				if err != nil {
+					return err
+				}
+			}
 
-		dataChunks, err := enc.Split(encryptedBlock)
-		if err != nil {
-			return nil, nil, err
-		}
+			var encryptedKeyBuf bytes.Buffer
+			err = tlockClient.Encrypt(&encryptedKeyBuf, bytes.NewReader(lockedKey), drandRound)
+			if err != nil {
+				return err
+			}
+			encryptedKey := encryptedKeyBuf.Bytes()
 
-		err = enc.Encode(dataChunks)
-		if err != nil {
-			return nil, nil, err
-		}
+			encryptedBlock, err := crypto.EncryptGCM(buffer[:read], key)
+			if err != nil {
+				return err
+			}
 
-		keyParts, err := shamir.Split(encryptedKey, config.TotalShards, config.DataShards)
-		if err != nil {
-			return nil, nil, err
-		}
+			dataChunks, err := enc.Split(encryptedBlock)
+			if err != nil {
+				return err
+			}
 
-		var shamirIndexes []byte
-		for k := range keyParts {
-			shamirIndexes = append(shamirIndexes, k)
+			err = enc.Encode(dataChunks)
+			if err != nil {
+				return err
+			}
+
+			keyParts, err := shamir.Split(encryptedKey, n.Config.TotalShards, n.Config.DataShards)
+			if err != nil {
+				return err
+			}
+
+			block = models.EncodedBlock{Index: blockID, EncryptedSize: len(encryptedBlock), AESKey: key, Nonce: crypto.NonceGCM(encryptedBlock)}
+			for k, part := range keyParts {
+				block.KeyIndexes = append(block.KeyIndexes, k)
+				block.KeyParts = append(block.KeyParts, part)
+			}
+			block.Shards = dataChunks[:n.Config.TotalShards]
 		}
-		results[blockID] = make(map[string][][]byte)
-		for i := 0; i < config.TotalShards; i++ {
-			payloadDati := dataChunks[i]
-			currentIndex := shamirIndexes[i]
-			rawKeyPart := keyParts[currentIndex]
-			finalKeyPayload := append([]byte{currentIndex}, rawKeyPart...)
-			dataSafe := make([]byte, len(payloadDati))
-			copy(dataSafe, payloadDati)
 
-			results[blockID]["key"] = append(results[blockID]["key"], finalKeyPayload)
-			results[blockID]["data"] = append(results[blockID]["data"], dataSafe)
+		select {
+		case blocks <- block:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 
 		blockID++
-		if n < blockSize {
+		if read < blockSize {
 			break
 		}
 	}
-	return results, blockSizes, nil
+	return nil
+}
+
+func (n *Node) encodeJournaledBlock(enc reedsolomon.Encoder, plainBlock []byte, journaled models.UploadJournalBlock) (models.EncodedBlock, error) {
+	key, err := n.Keys.OpenLocal(journaled.SealedKey)
+	if err != nil {
+		return models.EncodedBlock{}, fmt.Errorf("error opening the journaled key of block %d: %w", journaled.Index, err)
+	}
+	encryptedBlock, err := crypto.EncryptGCMWithNonce(plainBlock, key, journaled.Nonce)
+	if err != nil {
+		return models.EncodedBlock{}, err
+	}
+	dataChunks, err := enc.Split(encryptedBlock)
+	if err != nil {
+		return models.EncodedBlock{}, err
+	}
+	err = enc.Encode(dataChunks)
+	if err != nil {
+		return models.EncodedBlock{}, err
+	}
+	return models.EncodedBlock{
+		Index:         journaled.Index,
+		EncryptedSize: len(encryptedBlock),
+		Shards:        dataChunks[:n.Config.TotalShards],
+		KeyIndexes:    journaled.KeyIndexes,
+		KeyParts:      journaled.KeyParts,
+		AESKey:        key,
+		Nonce:         journaled.Nonce,
+	}, nil
+}
+
+func CountBlocks(fileSize int64, blockSize int) int {
+	return int((fileSize + int64(blockSize) - 1) / int64(blockSize))
 }
 
-func ReconstructAndSaveFileLocal(fileManifest *models.FileManifest, fileBlocks map[int][]models.ChunkRequest, destinationFolder string) (string, error) {
+func (n *Node) DownloadFile(fileManifest *models.FileManifest, destinationFolder string, identities []age.Identity) (string, error) {
+	if fileManifest.Sealed && len(identities) == 0 {
+		return "", ErrIdentityRequired
+	}
+	// a file locked on the local beacon could be opened by anyone right away
+	tNetwork, err := n.timeLockNetwork()
+	if err != nil {
+		return "", err
+	}
+	if fileManifest.TimeLockChain != tNetwork.ChainHash() {
+		return "", fmt.Errorf("%w: the manifest records the chain %q, this node uses %s", ErrTimeLockChain, fileManifest.TimeLockChain, tNetwork.ChainHash())
+	}
+	// the name comes from the publisher: it must not reach outside the download folder
+	fileName := filepath.Base(fileManifest.FileName)
+	if fileName == "." || fileName == ".." || fileName == string(filepath.Separator) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidFileName, fileManifest.FileName)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() { go n.flushNodeReports() }()
+
+	blocks := make(chan models.FetchedBlock, n.Config.MaxInFlightBlocks)
+	fetchErr := make(chan error, 1)
+	go func() {
+		fetchErr <- n.FetchBlocks(ctx, fileManifest, blocks)
+	}()
+
+	// the file is written aside and only takes its name once its hash matches
+	partPath, hashFile, err := n.ReconstructAndSaveFileLocal(fileManifest, blocks, destinationFolder, identities)
+	if err != nil {
+		cancel()
+		if ferr := <-fetchErr; ferr != nil && ferr != context.Canceled {
+			return "", ferr
+		}
+		return "", err
+	}
+	if err := <-fetchErr; err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	if hashFile != fileManifest.HashFile {
+		os.Remove(partPath)
+		n.ClearDownloadCache(fileManifest.FileId)
+		return "", ErrCorruptedFile
+	}
+	filePath := filepath.Join(destinationFolder, fileName)
+	err = os.Rename(partPath, filePath)
+	if err != nil {
+		os.Remove(partPath)
+		return "", fmt.Errorf("failed to move the file in place: %v", err)
+	}
+	err = n.ClearDownloadCache(fileManifest.FileId)
+	if err != nil {
+		log.Printf("[FileManagement] - Error clearing the download cache of file %s: %v\n", fileManifest.FileId, err)
+	}
+	return filePath, nil
+}
+
+// ReconstructAndSaveFileLocal writes the file to a temporary file in destinationFolder and
+// returns its path and the hash of its content. The temporary file is removed on error.
+func (n *Node) ReconstructAndSaveFileLocal(fileManifest *models.FileManifest, blocks <-chan models.FetchedBlock, destinationFolder string, identities []age.Identity) (_ string, _ string, err error) {
 	log.Println("[FileManagement] - Reconstructing...")
-	err := os.MkdirAll(destinationFolder, 0755)
+	err = os.MkdirAll(destinationFolder, 0755)
 	if err != nil {
-		return "", fmt.Errorf("failed to create destination folder: %v", err)
+		return "", "", fmt.Errorf("failed to create destination folder: %v", err)
 	}
 
-	tNetwork, err := tlock_http.NewNetwork(config.DrandRelays[rand.Intn(len(config.DrandRelays))], config.DrandChainHash)
+	tNetwork, err := n.timeLockNetwork()
 	if err != nil {
-		return "", fmt.Errorf("errore network tlock: %v", err)
+		return "", "", fmt.Errorf("errore network tlock: %v", err)
 	}
 	tlockClient := tlock.New(tNetwork)
 
-	filePath := filepath.Join(destinationFolder, fileManifest.FileName)
-	outFile, err := os.Create(filePath)
+	outFile, err := os.CreateTemp(destinationFolder, ".kairos-*.part")
 	if err != nil {
-		return "", fmt.Errorf("failed to create output file: %v", err)
+		return "", "", fmt.Errorf("failed to create output file: %v", err)
 	}
-	defer outFile.Close()
+	filePath := outFile.Name()
+	defer func() {
+		closeErr := outFile.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write the output file: %v", closeErr)
+		}
+		if err != nil {
+			os.Remove(filePath)
+		}
+	}()
+	hasher := sha256.New()
+	writer := io.MultiWriter(outFile, hasher)
 
 	enc, err := reedsolomon.New(fileManifest.ReedSolomonConfig.DataShards, fileManifest.ReedSolomonConfig.ParityShards)
 	if err != nil {
-		return "", fmt.Errorf("Reed-Solomon creation error: %v", err)
+		return "", "", fmt.Errorf("Reed-Solomon creation error: %v", err)
 	}
 
 	totalShards := fileManifest.ReedSolomonConfig.DataShards + fileManifest.ReedSolomonConfig.ParityShards
 
 	for i := 0; i < fileManifest.Blocks; i++ {
-		blockChunks, ok := fileBlocks[i]
-		if !ok {
-			return "", fmt.Errorf("missing data for block %d", i)
+		fetchedBlock, ok := <-blocks
+		if !ok || fetchedBlock.Index != i {
+			return "", "", fmt.Errorf("missing data for block %d", i)
 		}
+		blockChunks := fetchedBlock.Chunks
 		originalEncryptedSize := fileManifest.Split[i].EncryptedBlockSize
 		shards := make([][]byte, totalShards)
 		keyParts := make(map[byte][]byte)
@@ -161,71 +307,104 @@ func ReconstructAndSaveFileLocal(fileManifest *models.FileManifest, fileBlocks m
 			if !infoFound || shards[originalInfo.ShardIndex] != nil {
 				continue
 			}
+			if len(chunkReq.KeyPart) == 0 {
+				continue
+			}
 			shards[originalInfo.ShardIndex] = chunkReq.Shard
-			keyParts[originalInfo.KeyIndexPart] = originalInfo.KeyPart
+			keyParts[chunkReq.KeyIndexPart] = chunkReq.KeyPart
 			shardsReceived++
 		}
 		if shardsReceived < fileManifest.ReedSolomonConfig.DataShards {
-			return "", fmt.Errorf("insufficient data block %d", i)
+			return "", "", fmt.Errorf("insufficient data block %d", i)
 		}
 
 		err = enc.Reconstruct(shards)
 		if err != nil {
-			return "", fmt.Errorf("reconstruction failed for block %d: %v", i, err)
+			return "", "", fmt.Errorf("reconstruction failed for block %d: %v", i, err)
 		}
 		var encryptedBlock bytes.Buffer
 		err = enc.Join(&encryptedBlock, shards, originalEncryptedSize)
 		if err != nil {
-			return "", fmt.Errorf("failed to join shards: %v", err)
+			return "", "", fmt.Errorf("failed to join shards: %v", err)
 		}
 
 		encryptedAESKey, err := shamir.Combine(keyParts)
 		if err != nil {
-			return "", fmt.Errorf("failed to combine Shamir key: %v", err)
+			return "", "", fmt.Errorf("failed to combine Shamir key: %v", err)
 		}
 
 		var plainAESKeyBuf bytes.Buffer
 		err = tlockClient.Decrypt(&plainAESKeyBuf, bytes.NewReader(encryptedAESKey))
 		if err != nil {
-			return "", fmt.Errorf("failed to unlock the key with drand: %v", err)
+			return "", "", fmt.Errorf("failed to unlock the key with drand: %v", err)
 		}
 		plainAESKey := plainAESKeyBuf.Bytes()
+		if fileManifest.Sealed {
+			plainAESKey, err = crypto.UnwrapKey(plainAESKey, identities)
+			if err != nil {
+				return "", "", fmt.Errorf("%w: %v", ErrNotRecipient, err)
+			}
+		}
 
 		decryptedBlock, err := crypto.DecryptGCM(encryptedBlock.Bytes(), plainAESKey)
 		if err != nil {
-			return "", fmt.Errorf("failed to decrypt block AES: %v", err)
+			return "", "", fmt.Errorf("failed to decrypt block AES: %v", err)
 		}
 
-		_, err = outFile.Write(decryptedBlock)
+		_, err = writer.Write(decryptedBlock)
 		if err != nil {
-			return "", fmt.Errorf("failed to write block: %v", err)
+			return "", "", fmt.Errorf("failed to write block: %v", err)
 		}
 	}
 
-	return filePath, nil
+	return filePath, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func (n *Node) timeLockNetwork() (timelock.Network, error) {
+	return n.TimeLock.Network()
+}
+
+func (n *Node) GetRoundForTime(releaseTimeStr string) (uint64, error) {
+	round, _, err := n.GetRoundAndTimeForTime(releaseTimeStr)
+	return round, err
 }
 
-func GetRoundForTime(releaseTimeStr string) (uint64, error) {
+func (n *Node) GetRoundAndTimeForTime(releaseTimeStr string) (uint64, time.Time, error) {
 	targetTime, err := time.Parse(time.RFC3339, releaseTimeStr)
 	if err != nil {
-		return 0, err
+		return 0, time.Time{}, fmt.Errorf("%w: %v", ErrInvalidReleaseTime, err)
 	}
 
-	net, err := tlock_http.NewNetwork(config.DrandRelays[rand.Intn(len(config.DrandRelays))], config.DrandChainHash)
+	net, err := n.timeLockNetwork()
 	if err != nil {
-		return 0, err
+		return 0, time.Time{}, err
 	}
 
 	round := net.Current(targetTime)
 
 	if round == 0 {
-		return 0, err
+		return 0, time.Time{}, fmt.Errorf("%w: %s is before the genesis of the Drand chain", ErrInvalidReleaseTime, releaseTimeStr)
 	}
 
-	return round, nil
+	return round, net.RoundTime(round), nil
 }
 
-func GenerateFileManifest(mapping map[int]map[string][][]byte, blockSizes map[int]int, nodes []string, file multipart.File, header *multipart.FileHeader, releaseTime string) (*models.FileManifest, error) {
+func (n *Node) ValidateReleaseTime(releaseTimeStr string, allowImmediate bool) (uint64, time.Time, error) {
+	targetTime, err := time.Parse(time.RFC3339, releaseTimeStr)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("%w: %v", ErrInvalidReleaseTime, err)
+	}
+	now := time.Now()
+	if !allowImmediate && !targetTime.After(now) {
+		return 0, time.Time{}, fmt.Errorf("%w: %s is not in the future (use allow immediate to publish it readable right away)", ErrInvalidReleaseTime, releaseTimeStr)
+	}
+	if targetTime.After(now.Add(n.Config.MaxReleaseHorizon)) {
+		return 0, time.Time{}, fmt.Errorf("%w: %s is more than %s in the future", ErrInvalidReleaseTime, releaseTimeStr, n.Config.MaxReleaseHorizon)
+	}
+	return n.GetRoundAndTimeForTime(releaseTimeStr)
+}
+
+func (n *Node) GenerateFileManifest(blocks int, blockSize int, nodes []string, file multipart.File, header *multipart.FileHeader, releaseTime string) (*models.FileManifest, error) {
 	log.Printf("[FileManagement] - Generating file manifest...")
 	if _, err := file.Seek(0, 0); err != nil {
 		return nil, err
@@ -239,21 +418,29 @@ func GenerateFileManifest(mapping map[int]map[string][][]byte, blockSizes map[in
 	fileManifest.FileName = header.Filename
 	fileManifest.FileSize = header.Size
 	fileManifest.ReleaseDate = releaseTime
-	fileManifest.FileId = uuid.New().String()
+	// the FileId is bound to the publisher key, so downloaders don't have to trust the
+	// bootstrap server about who signed the manifest
+	fileManifest.FileId = uuid.New().String() + "." + crypto.PublisherTag(n.Keys.PublicKey())
 	fileManifest.HashFile = fileHash
 	fileManifest.HashAlgorithm = "SHA256"
-	fileManifest.Blocks = len(mapping)
-	fileManifest.ChunksPerBlocks = config.TotalShards
-	fileManifest.ReedSolomonConfig = models.ReedSolomonConfig{DataShards: config.DataShards, ParityShards: config.ParityShards}
+	tNetwork, err := n.timeLockNetwork()
+	if err != nil {
+		return nil, err
+	}
+	fileManifest.TimeLockChain = tNetwork.ChainHash()
+	fileManifest.Blocks = blocks
+	fileManifest.ChunksPerBlocks = n.Config.TotalShards
+	fileManifest.ReedSolomonConfig = models.ReedSolomonConfig{DataShards: n.Config.DataShards, ParityShards: n.Config.ParityShards}
 	fileManifest.Split = make(map[int]models.FileBlock)
-	for i := 0; i < len(mapping); i++ {
-		fileBlock := models.FileBlock{EncryptedBlockSize: blockSizes[i], Chunks: make([]models.Chunk, 0, config.TotalShards)}
-		for j := 0; j < len(mapping[i]["key"]); j++ {
-			keyPayload := mapping[i]["key"][j]
-			shamirIndex := keyPayload[0]
-			shamirPart := keyPayload[1:]
-			selectedNodes := pickRandomItems(nodes, config.ChunksTolerance)
-			chunk := models.Chunk{ShardIndex: j, KeyIndexPart: shamirIndex, KeyPart: shamirPart, Nodes: selectedNodes, ChunkId: uuid.New().String()}
+	for i := 0; i < blocks; i++ {
+		plainSize := header.Size - int64(i)*int64(blockSize)
+		if plainSize > int64(blockSize) {
+			plainSize = int64(blockSize)
+		}
+		fileBlock := models.FileBlock{EncryptedBlockSize: crypto.EncryptedSizeGCM(int(plainSize)), Chunks: make([]models.Chunk, 0, n.Config.TotalShards)}
+		for j := 0; j < n.Config.TotalShards; j++ {
+			selectedNodes := pickRandomItems(nodes, n.Config.ChunksTolerance)
+			chunk := models.Chunk{ShardIndex: j, Nodes: selectedNodes, ChunkId: uuid.New().String()}
 			fileBlock.Chunks = append(fileBlock.Chunks, chunk)
 		}
 		fileManifest.Split[i] = fileBlock
@@ -261,14 +448,14 @@ func GenerateFileManifest(mapping map[int]map[string][][]byte, blockSizes map[in
 	return &fileManifest, nil
 }
 
-func RequestNodesForFileUpload(totalChunks int) ([]string, error) {
-	chosenServer := rand.Intn(len(config.BootStrapServers))
-	request := models.NodesForFileUploadRequest{Address: config.OnionAddress + ":" + strconv.Itoa(config.Port), PublicKey: config.PublicKey, TotalChunks: totalChunks, NodesPerChunk: config.ChunksTolerance}
+func (n *Node) RequestNodesForFileUpload(totalChunks int) ([]string, error) {
+	chosenServer := rand.Intn(len(n.Config.BootStrapServers))
+	request := models.NodesForFileUploadRequest{Address: n.Address(), PublicKey: n.Keys.PublicKey(), TotalChunks: totalChunks, NodesPerChunk: n.Config.ChunksTolerance}
 	jsonBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
-	signature, err := crypto.SignMessage(jsonBytes)
+	signature, err := n.Keys.SignMessage(jsonBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -277,7 +464,7 @@ func RequestNodesForFileUpload(totalChunks int) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := config.HttpClient.Post(fmt.Sprintf("http://%s/file/nodes", config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytes))
+	resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/file/nodes", n.Config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return nil, err
 	}
@@ -291,23 +478,25 @@ func RequestNodesForFileUpload(totalChunks int) ([]string, error) {
 	}
 }
 
-func UploadFileManifest(fileManifest *models.FileManifest) error {
-	chosenServer := rand.Intn(len(config.BootStrapServers))
+func (n *Node) UploadFileManifest(fileManifest *models.FileManifest) error {
+	chosenServer := rand.Intn(len(n.Config.BootStrapServers))
+	// the servers keep the manifest with the highest signed version
+	fileManifest.Version = time.Now().UnixNano()
 	manifestBytes, err := json.Marshal(*fileManifest)
 	if err != nil {
 		return err
 	}
 	hashToSign := sha256.Sum256(manifestBytes)
-	signature, err := crypto.SignMessage(hashToSign[:])
+	signature, err := n.Keys.SignMessage(hashToSign[:])
 	if err != nil {
 		return err
 	}
-	fileManifestRequest := models.FileManifestRequest{Address: config.OnionAddress + ":" + strconv.Itoa(config.Port), PublicKey: config.PublicKey, Manifest: *fileManifest, Signature: signature}
+	fileManifestRequest := models.FileManifestRequest{Address: n.Address(), PublicKey: n.Keys.PublicKey(), Manifest: *fileManifest, Signature: signature}
 	jsonBytesToSend, err := json.Marshal(fileManifestRequest)
 	if err != nil {
 		return err
 	}
-	resp, err := config.HttpClient.Post(fmt.Sprintf("http://%s/file/manifest", config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytesToSend))
+	resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/file/manifest", n.Config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytesToSend))
 	if err != nil {
 		return err
 	}
@@ -319,53 +508,113 @@ func UploadFileManifest(fileManifest *models.FileManifest) error {
 	}
 }
 
-func UploadFile(fileManifest *models.FileManifest, mapping map[int]map[string][][]byte) error {
+func (n *Node) UploadFile(fileManifest *models.FileManifest, file io.ReadSeeker, blockSize int, options models.UploadOptions) (map[string][]string, error) {
+	err := n.createUploadJournal(fileManifest, blockSize, options)
+	if err != nil {
+		return nil, err
+	}
+	return n.uploadFile(fileManifest, file, blockSize, options, nil)
+}
+
+func (n *Node) ResumeUpload(fileId string, file io.ReadSeeker) (*models.FileManifest, map[string][]string, error) {
+	journal, err := n.GetUploadJournal(fileId)
+	if err != nil {
+		return nil, nil, err
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, nil, err
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != journal.Manifest.HashFile {
+		return nil, nil, fmt.Errorf("the file does not match the upload %s", fileId)
+	}
+	journaledBlocks, err := n.getJournalBlocks(fileId)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("[FileManagement] - Resuming upload of file %s (%d/%d blocks journaled)...", fileId, len(journaledBlocks), journal.Manifest.Blocks)
+	placed, err := n.uploadFile(&journal.Manifest, file, journal.BlockSize, journal.Options, journaledBlocks)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &journal.Manifest, placed, nil
+}
+
+func (n *Node) PublishFileManifest(fileManifest *models.FileManifest, placed map[string][]string) error {
+	for i, block := range fileManifest.Split {
+		for j := range block.Chunks {
+			block.Chunks[j].Nodes = placed[block.Chunks[j].ChunkId]
+		}
+		fileManifest.Split[i] = block
+	}
+	err := n.UploadFileManifest(fileManifest)
+	if err != nil {
+		return err
+	}
+	err = n.trackFile(fileManifest)
+	if err != nil {
+		log.Printf("[FileManagement] - Error tracking file %s for repair: %v\n", fileManifest.FileId, err)
+	}
+	return n.DeleteUploadJournal(fileManifest.FileId)
+}
+
+func (n *Node) uploadFile(fileManifest *models.FileManifest, file io.ReadSeeker, blockSize int, options models.UploadOptions, journal map[int]models.UploadJournalBlock) (map[string][]string, error) {
 	log.Printf("[FileManagement] - Uploading File %s to nodes...", fileManifest.FileId)
-	chunkRequest := models.ChunkRequest{Address: config.OnionAddress + ":" + strconv.Itoa(config.Port), PublicKey: config.PublicKey}
-	for i := 0; i < len(fileManifest.Split); i++ {
-		block := fileManifest.Split[i]
-		almostOneChunk := false
-		for j := 0; j < len(block.Chunks); j++ {
-			chunkRequest.Signature = nil
-			chunk := block.Chunks[j]
-			chunkRequest.ChunkId = chunk.ChunkId
-			chunkRequest.ReleaseDate = fileManifest.ReleaseDate
-			dataChunk := mapping[i]["data"][j]
-			chunkRequest.Shard = dataChunk
-			jsonBytes, err := json.Marshal(chunkRequest)
-			if err != nil {
-				continue
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() { go n.flushNodeReports() }()
+
+	blocks := make(chan models.EncodedBlock, n.Config.MaxInFlightBlocks)
+	splitErr := make(chan error, 1)
+	go func() {
+		splitErr <- n.SplitFile(ctx, file, blockSize, fileManifest.ReleaseDate, options.Recipients, journal, blocks)
+	}()
+
+	placed := make(map[string][]string)
+	uploaded := 0
+	for block := range blocks {
+		journaled, ok := journal[block.Index]
+		if !ok {
+			var err error
+			journaled, err = n.newJournalBlock(block)
+			if err == nil {
+				err = n.putJournalBlock(fileManifest.FileId, journaled)
 			}
-			signature, err := crypto.SignMessage(jsonBytes)
-			if err != nil {
-				continue
+			if err == nil {
+				err = n.recordStorageSamples(fileManifest.FileId, fileManifest.Split[block.Index], block)
 			}
-			chunkRequest.Signature = signature
-			jsonBytes, err = json.Marshal(chunkRequest)
 			if err != nil {
-				continue
-			}
-			for _, v := range chunk.Nodes {
-				resp, err := config.HttpClient.Post(fmt.Sprintf("http://%s/chunk", v), "application/json", bytes.NewBuffer(jsonBytes))
-				if err != nil {
-					continue
-				}
-				defer resp.Body.Close()
-				if resp.StatusCode == 200 {
-					almostOneChunk = true
-				} else {
-					continue
-				}
-			}
-			if !almostOneChunk {
-				break
+				cancel()
+				<-splitErr
+				return placed, err
 			}
 		}
-		if !almostOneChunk {
-			return fmt.Errorf("one block could not be sent")
+		confirmed, err := n.uploadBlock(ctx, fileManifest, block, options, journaled.Acks)
+		journaled.Acks = confirmed
+		for chunkId, nodes := range confirmed {
+			placed[chunkId] = nodes
 		}
+		if jerr := n.putJournalBlock(fileManifest.FileId, journaled); jerr != nil {
+			log.Printf("[FileManagement] - Error journaling block %d of file %s: %v\n", block.Index, fileManifest.FileId, jerr)
+		}
+		if err != nil {
+			cancel()
+			<-splitErr
+			return placed, err
+		}
+		uploaded++
 	}
-	return nil
+	if err := <-splitErr; err != nil {
+		return placed, err
+	}
+	if uploaded != fileManifest.Blocks {
+		return placed, fmt.Errorf("uploaded %d blocks, expected %d", uploaded, fileManifest.Blocks)
+	}
+	return placed, nil
 }
 
 func pickRandomItems(list []string, n int) []string {
@@ -382,14 +631,14 @@ func pickRandomItems(list []string, n int) []string {
 	return selected
 }
 
-func GetFileManifestFromServer(fileId string) (*models.FileManifest, error) {
-	chosenServer := rand.Intn(len(config.BootStrapServers))
-	request := models.GetFileManifestRequest{Address: config.OnionAddress + ":" + strconv.Itoa(config.Port), PublicKey: config.PublicKey, FileId: fileId}
+func (n *Node) GetFileManifestFromServer(fileId string) (*models.FileManifest, error) {
+	chosenServer := rand.Intn(len(n.Config.BootStrapServers))
+	request := models.GetFileManifestRequest{Address: n.Address(), PublicKey: n.Keys.PublicKey(), FileId: fileId}
 	jsonBytes, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
-	signature, err := crypto.SignMessage(jsonBytes)
+	signature, err := n.Keys.SignMessage(jsonBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -398,28 +647,127 @@ func GetFileManifestFromServer(fileId string) (*models.FileManifest, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := config.HttpClient.Post(fmt.Sprintf("http://%s/manifests", config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytes))
+	resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/manifests", n.Config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == 200 {
-		var response *models.FileManifest
-		json.NewDecoder(resp.Body).Decode(&response)
-		return response, nil
+		var envelope models.ManifestEnvelope
+		err = json.NewDecoder(resp.Body).Decode(&envelope)
+		if err != nil {
+			return nil, err
+		}
+		return verifyManifestEnvelope(fileId, envelope)
 	} else {
 		return nil, fmt.Errorf("error with message: %v", resp.Body)
 	}
 }
 
-func SaveChunk(r *http.Request) error {
+func verifyManifestEnvelope(fileId string, envelope models.ManifestEnvelope) (*models.FileManifest, error) {
+	hashToVerify := sha256.Sum256(envelope.Manifest)
+	check, err := crypto.VerifySignature(hashToVerify[:], envelope.Signature, envelope.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !check {
+		return nil, fmt.Errorf("the signature of the manifest %s is not valid", fileId)
+	}
+	err = verifyManifestPublisher(fileId, envelope)
+	if err != nil {
+		return nil, err
+	}
+	var fileManifest models.FileManifest
+	err = json.Unmarshal(envelope.Manifest, &fileManifest)
+	if err != nil {
+		return nil, err
+	}
+	if fileManifest.FileId != fileId {
+		return nil, fmt.Errorf("the server returned the manifest %s instead of %s", fileManifest.FileId, fileId)
+	}
+	return &fileManifest, nil
+}
+
+// verifyManifestPublisher checks that the manifest is signed by the key its FileId is
+// bound to or by a key it was rotated to: a valid signature alone could come from any key
+// the bootstrap server chose.
+func verifyManifestPublisher(fileId string, envelope models.ManifestEnvelope) error {
+	publisher := envelope.PublicKey
+	if len(envelope.Rotations) > 0 {
+		publisher = envelope.Rotations[0].OldPublicKey
+	}
+	i := strings.LastIndex(fileId, ".")
+	if i < 0 || fileId[i+1:] != crypto.PublisherTag(publisher) {
+		return fmt.Errorf("the manifest %s is not signed by the key its FileId is bound to", fileId)
+	}
+	current := publisher
+	for _, rotation := range envelope.Rotations {
+		if !crypto.SamePublicKey(rotation.OldPublicKey, current) {
+			return fmt.Errorf("broken rotation chain for the manifest %s", fileId)
+		}
+		err := verifyKeyRotation(rotation)
+		if err != nil {
+			return err
+		}
+		current = rotation.NewPublicKey
+	}
+	if !crypto.SamePublicKey(current, envelope.PublicKey) {
+		return fmt.Errorf("the rotations of the manifest %s don't lead to its signer", fileId)
+	}
+	return nil
+}
+
+func (n *Node) RevokeFile(fileId string) error {
+	fileManifest, err := n.GetFileManifestFromServer(fileId)
+	if err != nil {
+		return err
+	}
+	chosenServer := rand.Intn(len(n.Config.BootStrapServers))
+	request := models.RevokeFileManifestRequest{Address: n.Address(), PublicKey: n.Keys.PublicKey(), FileId: fileId}
+	jsonBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	signature, err := n.Keys.SignMessage(jsonBytes)
+	if err != nil {
+		return err
+	}
+	request.Signature = signature
+	jsonBytes, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/file/manifest/delete", n.Config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("error with message: %s", string(body))
+	}
+
+	placed := make(map[string][]string)
+	for _, block := range fileManifest.Split {
+		for _, chunk := range block.Chunks {
+			placed[chunk.ChunkId] = chunk.Nodes
+		}
+	}
+	n.RollbackUpload(fileManifest, placed)
+	n.UntrackFile(fileId)
+	return nil
+}
+
+func (n *Node) SaveChunk(r *http.Request) error {
 	var chunkRequest models.ChunkRequest
 	err := json.NewDecoder(r.Body).Decode(&chunkRequest)
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
-	message, err := json.Marshal(models.ChunkRequest{Address: chunkRequest.Address, PublicKey: chunkRequest.PublicKey, ChunkId: chunkRequest.ChunkId, Shard: chunkRequest.Shard, ReleaseDate: chunkRequest.ReleaseDate})
+	message, err := json.Marshal(models.ChunkRequest{Address: chunkRequest.Address, PublicKey: chunkRequest.PublicKey, ChunkId: chunkRequest.ChunkId, Shard: chunkRequest.Shard,
+		KeyIndexPart: chunkRequest.KeyIndexPart, KeyPart: chunkRequest.KeyPart, ReleaseDate: chunkRequest.ReleaseDate, AuthorizedKeys: chunkRequest.AuthorizedKeys,
+		EarlyRelease: chunkRequest.EarlyRelease})
 	if err != nil {
 		return err
 	}
@@ -428,27 +776,37 @@ func SaveChunk(r *http.Request) error {
 		return err
 	}
 	if check {
-		payload, err := json.Marshal(models.ChunkRequest{PublicKey: chunkRequest.PublicKey, Address: chunkRequest.Address, ChunkId: chunkRequest.ChunkId, Shard: chunkRequest.Shard, ReleaseDate: chunkRequest.ReleaseDate})
+		// a ChunkId is public in the manifest: only the key that stored it can replace it
+		stored, err := database.GetData(n.DB, "chunks", chunkRequest.ChunkId)
+		if err == nil {
+			var storedRequest models.ChunkRequest
+			if json.Unmarshal(stored, &storedRequest) != nil || !crypto.SamePublicKey(storedRequest.PublicKey, chunkRequest.PublicKey) {
+				return fmt.Errorf("%w: chunk %s was stored by another key", ErrChunkForbidden, chunkRequest.ChunkId)
+			}
+		}
+		payload, err := json.Marshal(models.ChunkRequest{PublicKey: chunkRequest.PublicKey, Address: chunkRequest.Address, ChunkId: chunkRequest.ChunkId, Shard: chunkRequest.Shard,
+			KeyIndexPart: chunkRequest.KeyIndexPart, KeyPart: chunkRequest.KeyPart, ReleaseDate: chunkRequest.ReleaseDate, AuthorizedKeys: chunkRequest.AuthorizedKeys,
+			EarlyRelease: chunkRequest.EarlyRelease})
 		if err != nil {
 			return err
 		}
-		err = database.PutData(config.BoltDB, "chunks", chunkRequest.ChunkId, payload)
+		err = database.PutData(n.DB, "chunks", chunkRequest.ChunkId, payload)
 		if err != nil {
 			return err
 		}
 	} else {
-		return err
+		return fmt.Errorf("sender not verified")
 	}
 	return nil
 }
 
-func GetChunk(r *http.Request) ([]byte, error) {
+func (n *Node) GetChunk(r *http.Request) ([]byte, error) {
 	chunkId := r.URL.Query().Get("chunkId")
 	if chunkId == "" {
 		return nil, fmt.Errorf("error 'chunkId' empty")
 	}
 	defer r.Body.Close()
-	chunk, err := database.GetData(config.BoltDB, "chunks", chunkId)
+	chunk, err := database.GetData(n.DB, "chunks", chunkId)
 	if err != nil {
 		return nil, err
 	}
@@ -457,11 +815,153 @@ func GetChunk(r *http.Request) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the uploader can always read its own chunks back, the repair of its files relies on it
+	requester, authErr := n.verifyChunkRequester(r, chunkRequest)
+	owner := authErr == nil && crypto.SamePublicKey(requester, chunkRequest.PublicKey)
+	if len(chunkRequest.AuthorizedKeys) > 0 && !owner {
+		if authErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrChunkForbidden, authErr)
+		}
+		if !slices.ContainsFunc(chunkRequest.AuthorizedKeys, func(key []byte) bool { return crypto.SamePublicKey(key, requester) }) {
+			return nil, fmt.Errorf("%w: sender not authorized", ErrChunkForbidden)
+		}
+	}
+	if n.Config.EnforceReleaseDate && !chunkRequest.EarlyRelease && !owner {
+		releaseTime, err := time.Parse(time.RFC3339, chunkRequest.ReleaseDate)
+		if err != nil {
+			return nil, err
+		}
+		// a small grace keeps downloads started right at the release working across clock drift
+		if time.Now().Add(n.Config.ReleaseSkew).Before(releaseTime) {
+			return nil, ErrChunkNotReleased
+		}
+	}
 	return chunk, nil
 }
 
-func RequestChunk(node string, chunkId string) (*models.ChunkRequest, error) {
-	resp, err := config.HttpClient.Get(fmt.Sprintf("http://%s/chunk?chunkId=%s", node, chunkId))
+func (n *Node) verifyChunkRequester(r *http.Request, chunkRequest models.ChunkRequest) ([]byte, error) {
+	header := r.Header.Get(chunkAuthHeader)
+	if header == "" {
+		return nil, fmt.Errorf("missing signed request")
+	}
+	rawRequest, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, err
+	}
+	var getRequest models.GetChunkRequest
+	err = json.Unmarshal(rawRequest, &getRequest)
+	if err != nil {
+		return nil, err
+	}
+	if getRequest.ChunkId != chunkRequest.ChunkId {
+		return nil, fmt.Errorf("signed request for another chunk")
+	}
+	skew := time.Since(time.Unix(0, getRequest.Timestamp))
+	if skew > n.Config.ChunkRequestMaxSkew || skew < -n.Config.ChunkRequestMaxSkew {
+		return nil, fmt.Errorf("signed request expired")
+	}
+	message, err := json.Marshal(models.GetChunkRequest{Address: getRequest.Address, PublicKey: getRequest.PublicKey, ChunkId: getRequest.ChunkId, Timestamp: getRequest.Timestamp})
+	if err != nil {
+		return nil, err
+	}
+	check, err := crypto.VerifySignature(message, getRequest.Signature, getRequest.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !check {
+		return nil, fmt.Errorf("sender not verified")
+	}
+	return getRequest.PublicKey, nil
+}
+
+func (n *Node) HasChunk(r *http.Request) bool {
+	chunkId := r.URL.Query().Get("chunkId")
+	if chunkId == "" {
+		return false
+	}
+	_, err := database.GetData(n.DB, "chunks", chunkId)
+	return err == nil
+}
+
+func (n *Node) signChunkRequest(chunkId string, publicKey []byte) (string, error) {
+	getRequest := models.GetChunkRequest{Address: n.Address(), PublicKey: publicKey, ChunkId: chunkId, Timestamp: time.Now().UnixNano()}
+	jsonBytes, err := json.Marshal(getRequest)
+	if err != nil {
+		return "", err
+	}
+	signature, err := n.Keys.SignMessageAs(publicKey, jsonBytes)
+	if err != nil {
+		return "", err
+	}
+	getRequest.Signature = signature
+	jsonBytes, err = json.Marshal(getRequest)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(jsonBytes), nil
+}
+
+func (n *Node) DeleteChunk(r *http.Request) error {
+	var deleteRequest models.DeleteChunkRequest
+	err := json.NewDecoder(r.Body).Decode(&deleteRequest)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	skew := time.Since(time.Unix(0, deleteRequest.Timestamp))
+	if skew > n.Config.ChunkRequestMaxSkew || skew < -n.Config.ChunkRequestMaxSkew {
+		return fmt.Errorf("signed request expired")
+	}
+	message, err := json.Marshal(models.DeleteChunkRequest{Address: deleteRequest.Address, PublicKey: deleteRequest.PublicKey, ChunkId: deleteRequest.ChunkId,
+		Timestamp: deleteRequest.Timestamp})
+	if err != nil {
+		return err
+	}
+	check, err := crypto.VerifySignature(message, deleteRequest.Signature, deleteRequest.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("sender not verified")
+	}
+	chunk, err := database.GetData(n.DB, "chunks", deleteRequest.ChunkId)
+	if err != nil {
+		return err
+	}
+	var chunkRequest models.ChunkRequest
+	err = json.Unmarshal(chunk, &chunkRequest)
+	if err != nil {
+		return err
+	}
+	if !crypto.SamePublicKey(chunkRequest.PublicKey, deleteRequest.PublicKey) {
+		return fmt.Errorf("%w: chunk %s was not stored by the sender", ErrChunkForbidden, deleteRequest.ChunkId)
+	}
+	return database.DeleteKey(n.DB, "chunks", deleteRequest.ChunkId)
+}
+
+// RequestChunk downloads a chunk. A holder that refuses the current key is asked again
+// with the retired ones, which the chunks and authorizations older than a rotation name.
+func (n *Node) RequestChunk(ctx context.Context, node string, chunkId string) (*models.ChunkRequest, error) {
+	var chunk *models.ChunkRequest
+	err := n.asOwner(func(publicKey []byte) error {
+		var err error
+		chunk, err = n.requestChunkAs(ctx, node, chunkId, publicKey)
+		return err
+	})
+	return chunk, err
+}
+
+func (n *Node) requestChunkAs(ctx context.Context, node string, chunkId string, publicKey []byte) (*models.ChunkRequest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/chunk?chunkId=%s", node, chunkId), nil)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := n.signChunkRequest(chunkId, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(chunkAuthHeader, auth)
+	resp, err := n.HttpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -475,6 +975,12 @@ func RequestChunk(node string, chunkId string) (*models.ChunkRequest, error) {
 		return &chunkRequest, nil
 	} else {
 		body, _ := io.ReadAll(resp.Body)
+		switch resp.StatusCode {
+		case http.StatusForbidden:
+			return nil, fmt.Errorf("%w: %s", ErrChunkForbidden, string(body))
+		case http.StatusTooEarly:
+			return nil, fmt.Errorf("%w: %s", ErrChunkNotReleased, string(body))
+		}
 		return nil, fmt.Errorf("error: %s", string(body))
 	}
 }
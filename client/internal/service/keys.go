@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/crypto"
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+var ErrNodeNotStarted = errors.New("the node is not started")
+
+func GenerateKey() (ed25519.PrivateKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	return privateKey, err
+}
+
+// RotateKey replaces the node key with newKey. The rotation is announced to the bootstrap
+// servers, signed by both keys, so they move the ownership of the published manifests
+// to the new key. The old private key is kept in RetiredKeysDir: the chunks stored before
+// the rotation stay bound to it on their holders.
+func (n *Node) RotateKey(newKey ed25519.PrivateKey) error {
+	if !n.Started() {
+		return ErrNodeNotStarted
+	}
+	oldKey, err := crypto.ParsePrivateKey(n.Keys.PrivateKey())
+	if err != nil {
+		return err
+	}
+	newPublicKey, err := crypto.EncodePublicKey(newKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	if crypto.SamePublicKey(newPublicKey, n.Keys.PublicKey()) {
+		return fmt.Errorf("the new key is the same as the current one")
+	}
+
+	rotation := models.KeyRotationRequest{Address: n.Address(), OldPublicKey: n.Keys.PublicKey(),
+		NewPublicKey: newPublicKey, RotatedAt: time.Now().UnixNano()}
+	message, err := json.Marshal(rotation)
+	if err != nil {
+		return err
+	}
+	rotation.OldSignature = ed25519.Sign(oldKey, message)
+	rotation.NewSignature = ed25519.Sign(newKey, message)
+
+	// both keys are on disk before the announcement: once the servers move the manifests
+	// to the new key, losing it would lose them too
+	retiredPath, err := n.retireKey(n.Keys.PrivateKey())
+	if err != nil {
+		return err
+	}
+	err = n.Keys.WriteKeyPair(newKey)
+	if err != nil {
+		os.Remove(retiredPath)
+		return err
+	}
+	err = n.announceKeyRotation(rotation)
+	if err != nil {
+		// no server knows the new key, go back to the old one
+		restoreErr := n.Keys.WriteKeyPair(oldKey)
+		if restoreErr == nil {
+			os.Remove(retiredPath)
+		}
+		return errors.Join(err, restoreErr)
+	}
+	err = n.Keys.LoadOrCreateKeyPair()
+	if err != nil {
+		return err
+	}
+	log.Printf("[Keys] - Key %s rotated to %s\n", crypto.Fingerprint(rotation.OldPublicKey), crypto.Fingerprint(newPublicKey))
+
+	// refresh the subscription right away instead of waiting for the next heartbeat
+	err = n.SubscribeNode()
+	if err != nil {
+		log.Println("[Keys] - Error subscribing with the new key: ", err)
+	}
+	return nil
+}
+
+// verifyKeyRotation checks that the rotation is signed by both keys.
+func verifyKeyRotation(rotation models.KeyRotationRequest) error {
+	if crypto.SamePublicKey(rotation.OldPublicKey, rotation.NewPublicKey) {
+		return fmt.Errorf("the new key is the same as the old one")
+	}
+	message, err := json.Marshal(models.KeyRotationRequest{Address: rotation.Address, OldPublicKey: rotation.OldPublicKey,
+		NewPublicKey: rotation.NewPublicKey, RotatedAt: rotation.RotatedAt})
+	if err != nil {
+		return err
+	}
+	check, err := crypto.VerifySignature(message, rotation.OldSignature, rotation.OldPublicKey)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("rotation not signed by the old key")
+	}
+	check, err = crypto.VerifySignature(message, rotation.NewSignature, rotation.NewPublicKey)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("rotation not signed by the new key")
+	}
+	return nil
+}
+
+func (n *Node) announceKeyRotation(rotation models.KeyRotationRequest) error {
+	jsonBytes, err := json.Marshal(rotation)
+	if err != nil {
+		return err
+	}
+	announced := 0
+	var lastErr error
+	for _, server := range n.Config.BootStrapServers {
+		resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/keys/rotate", server), "application/json", bytes.NewBuffer(jsonBytes))
+		if err != nil {
+			log.Printf("[Keys] - Error announcing the rotation to http://%s: %v\n", server, err)
+			lastErr = err
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			lastErr = fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+			log.Printf("[Keys] - Rotation refused by http://%s: %v\n", server, lastErr)
+			continue
+		}
+		announced++
+	}
+	// the bootstrap servers synchronize the rotation, one is enough
+	if len(n.Config.BootStrapServers) > 0 && announced == 0 {
+		return fmt.Errorf("rotation not announced to any bootstrap server: %v", lastErr)
+	}
+	return nil
+}
+
+func (n *Node) retireKey(privateKeyPEM []byte) (string, error) {
+	err := os.MkdirAll(n.Config.RetiredKeysDir, 0700)
+	if err != nil {
+		return "", err
+	}
+	// named after the rotation time: two rotations must not overwrite each other's retired
+	// key, the chunks bound to it could not be deleted or challenged anymore
+	path := filepath.Join(n.Config.RetiredKeysDir, fmt.Sprintf("private_key_%d.age", time.Now().UnixNano()))
+	return path, n.Keys.SealNewPrivateKey(privateKeyPEM, path)
+}
+
+// asOwner sends an owner request with the current key and then with the retired ones,
+// until a holder accepts it: the chunks stored before a rotation stay bound to the key
+// that uploaded them.
+func (n *Node) asOwner(request func(publicKey []byte) error) error {
+	var err error
+	for _, publicKey := range n.Keys.PublicKeys() {
+		err = request(publicKey)
+		if !errors.Is(err, ErrChunkForbidden) && !errors.Is(err, ErrChunkNotReleased) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/FraMan97/kairos/client/internal/config"
+	"github.com/FraMan97/kairos/client/internal/crypto"
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+	"github.com/FraMan97/kairos/client/internal/timelock"
+	"github.com/FraMan97/kairos/client/internal/transport"
+	"github.com/boltdb/bolt"
+)
+
+var buckets = []string{"chunks", "uploads", "downloads", "tracked", "samples", "reputation"}
+
+// Node is a Kairos node: its settings, database, keys and the way it reaches the others.
+// Nothing is shared between two nodes, so several of them can run in one process.
+type Node struct {
+	Config    *config.Config
+	DB        *bolt.DB
+	Keys      *crypto.KeyStore
+	Transport transport.Transport
+	TimeLock  timelock.TimeLockProvider
+
+	// set by /start while the background jobs may already read them
+	transportMu sync.RWMutex
+	httpClient  *http.Client
+	// host advertised to the others: the .onion address with Tor, AdvertiseHost with the loopback transport
+	onionAddress string
+
+	reportsMu      sync.Mutex
+	pendingReports []models.NodeReport
+}
+
+// NewNode opens the database of the node and creates its buckets. The keystore is still
+// locked: set its passphrase and call LoadOrCreateKeyPair before using the node.
+func NewNode(cfg *config.Config, nodeTransport transport.Transport, timeLock timelock.TimeLockProvider) (*Node, error) {
+	db, err := database.OpenDatabase(cfg.DatabaseDir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	for _, bucket := range buckets {
+		err = database.EnsureBucket(db, bucket)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating bucket '%s': %w", bucket, err)
+		}
+	}
+	return &Node{
+		Config:    cfg,
+		DB:        db,
+		Keys:      crypto.NewKeyStore(cfg),
+		Transport: nodeTransport,
+		TimeLock:  timeLock,
+	}, nil
+}
+
+func (n *Node) Close() error {
+	return n.DB.Close()
+}
+
+// Address is the address the others reach the node at.
+func (n *Node) Address() string {
+	n.transportMu.RLock()
+	defer n.transportMu.RUnlock()
+	return n.onionAddress + ":" + strconv.Itoa(n.Config.Port)
+}
+
+// Started tells if /start made the node reachable: before it the node has no address.
+func (n *Node) Started() bool {
+	n.transportMu.RLock()
+	defer n.transportMu.RUnlock()
+	return n.onionAddress != "" && n.Keys.PublicKey() != nil
+}
+
+// HttpClient is the client reaching the others through the transport, nil before /start.
+func (n *Node) HttpClient() *http.Client {
+	n.transportMu.RLock()
+	defer n.transportMu.RUnlock()
+	return n.httpClient
+}
+
+// StartTransport makes the node reachable and sets the advertised address and the http
+// client used to reach the others.
+func (n *Node) StartTransport() (string, error) {
+	addr, err := n.Transport.Start()
+	if err != nil {
+		return "", err
+	}
+	client := n.Transport.Client()
+	n.transportMu.Lock()
+	n.onionAddress = addr
+	n.httpClient = client
+	n.transportMu.Unlock()
+	return addr, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+// queueNodeReport keeps the outcome of an exchange with a node until the next flush to a
+// bootstrap server. Outcomes that say nothing about the node (our own cancellation, a chunk
+// refused by its access rules) are not reported.
+func (n *Node) queueNodeReport(node string, operation string, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrChunkForbidden) || errors.Is(err, ErrChunkNotReleased) {
+		return
+	}
+	n.reportsMu.Lock()
+	defer n.reportsMu.Unlock()
+	n.pendingReports = append(n.pendingReports, models.NodeReport{Node: node, Operation: operation, Success: err == nil})
+	if len(n.pendingReports) > n.Config.MaxPendingReports {
+		n.pendingReports = n.pendingReports[len(n.pendingReports)-n.Config.MaxPendingReports:]
+	}
+}
+
+func (n *Node) flushNodeReports() {
+	n.reportsMu.Lock()
+	reports := n.pendingReports
+	n.pendingReports = nil
+	n.reportsMu.Unlock()
+	if len(reports) == 0 || len(n.Config.BootStrapServers) == 0 {
+		return
+	}
+
+	err := n.sendNodeReports(reports)
+	if err != nil {
+		log.Println("[Report] - Error sending the node reports, keeping them for the next flush: ", err)
+		n.reportsMu.Lock()
+		n.pendingReports = append(reports, n.pendingReports...)
+		if len(n.pendingReports) > n.Config.MaxPendingReports {
+			n.pendingReports = n.pendingReports[len(n.pendingReports)-n.Config.MaxPendingReports:]
+		}
+		n.reportsMu.Unlock()
+		return
+	}
+	log.Printf("[Report] - %d node reports sent\n", len(reports))
+}
+
+func (n *Node) sendNodeReports(reports []models.NodeReport) error {
+	chosenServer := rand.Intn(len(n.Config.BootStrapServers))
+	request := models.NodeReportRequest{Address: n.Address(), PublicKey: n.Keys.PublicKey(), Reports: reports}
+	jsonBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	signature, err := n.Keys.SignMessage(jsonBytes)
+	if err != nil {
+		return err
+	}
+	request.Signature = signature
+	jsonBytes, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/nodes/report", n.Config.BootStrapServers[chosenServer]), "application/json", bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
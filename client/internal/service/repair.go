@@ -0,0 +1,314 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+	"github.com/klauspost/reedsolomon"
+)
+
+type probeResult struct {
+	chunkId string
+	node    string
+	alive   bool
+}
+
+func (n *Node) RepairFiles(ctx context.Context) {
+	ticker := time.NewTicker(getDelay(n.Config.CronRepair))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !n.Started() {
+				continue
+			}
+			n.repairTrackedFiles(ctx)
+
+		case <-ctx.Done():
+			log.Println("[Repair] - Context cancelled, stopping ticker")
+			return
+		}
+	}
+}
+
+func (n *Node) repairTrackedFiles(ctx context.Context) {
+	trackedFiles, err := database.GetAllData(n.DB, "tracked")
+	if err != nil {
+		log.Println("[Repair] - Error: ", err)
+		return
+	}
+	for fileId, data := range trackedFiles {
+		var tracked models.TrackedFile
+		err = json.Unmarshal(data, &tracked)
+		if err != nil {
+			log.Println("[Repair] - Error: ", err)
+			continue
+		}
+		releaseTime, err := time.Parse(time.RFC3339, tracked.Manifest.ReleaseDate)
+		if err == nil && time.Now().After(releaseTime.Add(time.Hour*24*7)) { // nodes clean the chunks 1 week after the release
+			n.UntrackFile(fileId)
+			continue
+		}
+		err = n.RepairFile(ctx, &tracked)
+		if err != nil {
+			log.Printf("[Repair] - Error repairing file %s: %v\n", fileId, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (n *Node) RepairFile(ctx context.Context, tracked *models.TrackedFile) error {
+	scheduler := n.newFetchScheduler()
+	defer n.flushNodeReports()
+	fileManifest := &tracked.Manifest
+	dataShards := fileManifest.ReedSolomonConfig.DataShards
+	totalShards := dataShards + fileManifest.ReedSolomonConfig.ParityShards
+
+	updated := false
+	for i := 0; i < fileManifest.Blocks; i++ {
+		block := fileManifest.Split[i]
+		alive := n.probeBlock(ctx, scheduler, block)
+		available := 0
+		for _, chunk := range block.Chunks {
+			if len(alive[chunk.ChunkId]) > 0 {
+				available++
+			}
+		}
+		if available == totalShards || available > dataShards+n.Config.RepairMargin {
+			continue
+		}
+		if available < dataShards {
+			log.Printf("[Repair] - Block %d of file %s cannot be repaired: %d shards left, required %d\n", i, fileManifest.FileId, available, dataShards)
+			continue
+		}
+
+		log.Printf("[Repair] - Block %d of file %s has %d/%d shards available, repairing...\n", i, fileManifest.FileId, available, totalShards)
+		holders, err := n.repairBlock(ctx, scheduler, tracked, i, alive)
+		if err != nil {
+			log.Printf("[Repair] - Error repairing block %d of file %s: %v\n", i, fileManifest.FileId, err)
+			continue
+		}
+		for j := range block.Chunks {
+			block.Chunks[j].Nodes = holders[block.Chunks[j].ChunkId]
+		}
+		fileManifest.Split[i] = block
+		updated = true
+	}
+	if !updated {
+		return nil
+	}
+
+	err := n.UploadFileManifest(fileManifest)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Repair] - Manifest of file %s updated with the new holders\n", fileManifest.FileId)
+	return n.putTrackedFile(*tracked)
+}
+
+func (n *Node) probeBlock(ctx context.Context, scheduler *fetchScheduler, block models.FileBlock) map[string][]string {
+	results := make(chan probeResult)
+	var wg sync.WaitGroup
+	for _, chunk := range block.Chunks {
+		for _, node := range chunk.Nodes {
+			wg.Add(1)
+			go func(chunkId string, node string) {
+				defer wg.Done()
+				release, err := scheduler.acquire(ctx, node)
+				if err != nil {
+					results <- probeResult{chunkId: chunkId, node: node}
+					return
+				}
+				defer release()
+				results <- probeResult{chunkId: chunkId, node: node, alive: n.probeChunk(ctx, node, chunkId)}
+			}(chunk.ChunkId, node)
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	alive := make(map[string][]string)
+	for result := range results {
+		if result.alive {
+			alive[result.chunkId] = append(alive[result.chunkId], result.node)
+		}
+	}
+	return alive
+}
+
+func (n *Node) probeChunk(ctx context.Context, node string, chunkId string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf("http://%s/chunk?chunkId=%s", node, chunkId), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := n.HttpClient().Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (n *Node) repairBlock(ctx context.Context, scheduler *fetchScheduler, tracked *models.TrackedFile, blockIndex int, alive map[string][]string) (map[string][]string, error) {
+	fileManifest := &tracked.Manifest
+	block := fileManifest.Split[blockIndex]
+	keys, ok := tracked.Blocks[blockIndex]
+	if !ok || len(keys.KeyParts) != len(block.Chunks) {
+		return nil, fmt.Errorf("no key parts tracked for block %d", blockIndex)
+	}
+	if len(keys.ShardHashes) != len(block.Chunks) {
+		return nil, fmt.Errorf("no shard hashes tracked for block %d", blockIndex)
+	}
+	dataShards := fileManifest.ReedSolomonConfig.DataShards
+	enc, err := reedsolomon.New(dataShards, fileManifest.ReedSolomonConfig.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	shards := make([][]byte, len(block.Chunks))
+	received := 0
+	var missing []models.Chunk
+	for _, chunk := range block.Chunks {
+		if len(alive[chunk.ChunkId]) == 0 {
+			missing = append(missing, chunk)
+			continue
+		}
+		if received == dataShards {
+			continue
+		}
+		// a holder answering with another shard would poison every rebuilt one
+		fetched, _, err := n.fetchChunk(ctx, scheduler, models.Chunk{ChunkId: chunk.ChunkId, ShardIndex: chunk.ShardIndex, Nodes: alive[chunk.ChunkId]},
+			verifyShardHash(chunk.ChunkId, keys.ShardHashes[chunk.ShardIndex]))
+		if err != nil {
+			log.Printf("[Repair] - Error fetching chunk %s: %v\n", chunk.ChunkId, err)
+			continue
+		}
+		shards[chunk.ShardIndex] = fetched.Shard
+		received++
+	}
+	if received < dataShards {
+		return nil, fmt.Errorf("fetched %d shards, required %d", received, dataShards)
+	}
+	err = enc.Reconstruct(shards)
+	if err != nil {
+		return nil, err
+	}
+	for i, shard := range shards {
+		if !matchesShardHash(shard, keys.ShardHashes[i]) {
+			return nil, fmt.Errorf("rebuilt shard %d does not match the shard uploaded", i)
+		}
+	}
+	// every shard is in hand: the chunks get a fresh set of storage samples
+	err = n.recordStorageSamples(fileManifest.FileId, block, models.EncodedBlock{Shards: shards})
+	if err != nil {
+		log.Printf("[Repair] - Error drawing new storage samples for block %d: %v\n", blockIndex, err)
+	}
+
+	candidates, err := n.RequestNodesForFileUpload(len(missing))
+	if err != nil {
+		return nil, err
+	}
+	// prefer nodes that do not already hold a shard of the same block
+	fresh := make([]string, 0, len(candidates))
+	for _, node := range candidates {
+		holding := false
+		for _, nodes := range alive {
+			if slices.Contains(nodes, node) {
+				holding = true
+				break
+			}
+		}
+		if !holding {
+			fresh = append(fresh, node)
+		}
+	}
+	if len(fresh) >= n.Config.ChunksTolerance {
+		candidates = fresh
+	}
+
+	chunks := make([]models.Chunk, 0, len(block.Chunks))
+	for _, chunk := range block.Chunks {
+		if len(alive[chunk.ChunkId]) == 0 {
+			chunk.Nodes = pickRandomItems(slices.Clone(candidates), n.Config.ChunksTolerance)
+		} else {
+			chunk.Nodes = alive[chunk.ChunkId]
+		}
+		chunks = append(chunks, chunk)
+	}
+	repairManifest := *fileManifest
+	repairManifest.Split = map[int]models.FileBlock{blockIndex: {EncryptedBlockSize: block.EncryptedBlockSize, Chunks: chunks}}
+
+	encodedBlock := models.EncodedBlock{Index: blockIndex, EncryptedSize: block.EncryptedBlockSize, Shards: shards, KeyIndexes: keys.KeyIndexes, KeyParts: keys.KeyParts}
+	return n.uploadBlock(ctx, &repairManifest, encodedBlock, tracked.Options, alive)
+}
+
+func (n *Node) trackFile(fileManifest *models.FileManifest) error {
+	journal, err := n.GetUploadJournal(fileManifest.FileId)
+	if err != nil {
+		return err
+	}
+	journalBlocks, err := n.getJournalBlocks(fileManifest.FileId)
+	if err != nil {
+		return err
+	}
+	tracked := models.TrackedFile{Manifest: *fileManifest, Options: journal.Options, Blocks: make(map[int]models.TrackedBlock)}
+	for i, block := range journalBlocks {
+		tracked.Blocks[i] = models.TrackedBlock{KeyIndexes: block.KeyIndexes, KeyParts: block.KeyParts, ShardHashes: block.ShardHashes}
+	}
+	return n.putTrackedFile(tracked)
+}
+
+func (n *Node) putTrackedFile(tracked models.TrackedFile) error {
+	payload, err := json.Marshal(tracked)
+	if err != nil {
+		return err
+	}
+	return database.PutData(n.DB, "tracked", tracked.Manifest.FileId, payload)
+}
+
+func (n *Node) UntrackFile(fileId string) error {
+	err := n.deleteStorageSamples(fileId)
+	if err != nil {
+		return err
+	}
+	return database.DeleteKey(n.DB, "tracked", fileId)
+}
+
+func shardHashes(shards [][]byte) [][]byte {
+	hashes := make([][]byte, len(shards))
+	for i, shard := range shards {
+		hash := sha256.Sum256(shard)
+		hashes[i] = hash[:]
+	}
+	return hashes
+}
+
+// verifyShardHash refuses a fetched chunk whose shard is not the one uploaded.
+func verifyShardHash(chunkId string, shardHash []byte) func(*models.ChunkRequest) error {
+	return func(fetched *models.ChunkRequest) error {
+		if !matchesShardHash(fetched.Shard, shardHash) {
+			return fmt.Errorf("chunk %s does not match the shard uploaded", chunkId)
+		}
+		return nil
+	}
+}
+
+func matchesShardHash(shard []byte, expected []byte) bool {
+	hash := sha256.Sum256(shard)
+	return bytes.Equal(hash[:], expected)
+}
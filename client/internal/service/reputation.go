@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+// recordNodeResult counts the outcome of a storage challenge answered by node.
+func (n *Node) recordNodeResult(node string, success bool) {
+	reputation := n.getNodeReputation(node)
+	now := time.Now().Unix()
+	if success {
+		reputation.Successes++
+		reputation.LastSuccess = now
+	} else {
+		reputation.Failures++
+	}
+	reputation.LastChallenge = now
+	reputation.Score = reputationScore(reputation)
+	payload, err := json.Marshal(reputation)
+	if err != nil {
+		log.Println("[Reputation] - Error: ", err)
+		return
+	}
+	err = database.PutData(n.DB, "reputation", node, payload)
+	if err != nil {
+		log.Println("[Reputation] - Error: ", err)
+	}
+}
+
+func (n *Node) getNodeReputation(node string) models.NodeReputation {
+	var reputation models.NodeReputation
+	data, err := database.GetData(n.DB, "reputation", node)
+	if err != nil {
+		return reputation
+	}
+	json.Unmarshal(data, &reputation)
+	return reputation
+}
+
+// reputationScore is the share of successful answers, smoothed so that a node
+// with no history starts at 0.5 instead of jumping to 0 or 1 on its first answer.
+func reputationScore(reputation models.NodeReputation) float64 {
+	return float64(reputation.Successes+1) / float64(reputation.Successes+reputation.Failures+2)
+}
+
+func (n *Node) GetNodeReputations() (map[string]models.NodeReputation, error) {
+	data, err := database.GetAllData(n.DB, "reputation")
+	if err != nil {
+		return nil, err
+	}
+	reputations := make(map[string]models.NodeReputation)
+	for node, v := range data {
+		var reputation models.NodeReputation
+		err = json.Unmarshal(v, &reputation)
+		if err != nil {
+			return nil, err
+		}
+		reputations[node] = reputation
+	}
+	return reputations, nil
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/crypto"
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+// a shorter range would let the challenger read the shard a few bytes at a time
+const minChallengeLength = 32
+
+var (
+	ErrNoStorageSamples = errors.New("no storage samples left")
+	ErrChunkNotFound    = errors.New("chunk not stored")
+	ErrProofFailed      = errors.New("the node did not prove it stores the chunk")
+)
+
+type challengeTarget struct {
+	tracked *models.TrackedFile
+	block   int
+	chunk   models.Chunk
+	node    string
+}
+
+func storageProof(nonce []byte, shard []byte, offset int, length int) ([]byte, error) {
+	if offset < 0 || length <= 0 || offset+length > len(shard) {
+		return nil, fmt.Errorf("range %d+%d out of the shard (%d bytes)", offset, length, len(shard))
+	}
+	hasher := sha256.New()
+	hasher.Write(nonce)
+	hasher.Write(shard[offset : offset+length])
+	return hasher.Sum(nil), nil
+}
+
+// Every sample is used for a single challenge: once its nonce has been sent
+// a node could keep the answer instead of the shard.
+func (n *Node) recordStorageSamples(fileId string, block models.FileBlock, encodedBlock models.EncodedBlock) error {
+	for _, chunk := range block.Chunks {
+		err := n.recordShardSamples(fileId, chunk.ChunkId, encodedBlock.Shards[chunk.ShardIndex])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordShardSamples replaces the samples of a chunk with ChallengeSamples new ones drawn
+// from its shard.
+func (n *Node) recordShardSamples(fileId string, chunkId string, shard []byte) error {
+	length := min(max(n.Config.ChallengeSampleSize, minChallengeLength), len(shard))
+	samples := make([]models.StorageSample, 0, n.Config.ChallengeSamples)
+	for i := 0; i < n.Config.ChallengeSamples; i++ {
+		nonce := make([]byte, 32)
+		if _, err := cryptorand.Read(nonce); err != nil {
+			return err
+		}
+		offset := rand.Intn(len(shard) - length + 1)
+		proof, err := storageProof(nonce, shard, offset, length)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, models.StorageSample{Nonce: nonce, Offset: offset, Length: length, Proof: proof})
+	}
+	payload, err := json.Marshal(samples)
+	if err != nil {
+		return err
+	}
+	return database.PutData(n.DB, "samples", sampleKey(fileId, chunkId), payload)
+}
+
+// refillStorageSamples draws new samples for a chunk that used all of its own. The owner
+// reads the shard back from a holder and checks it against the hash recorded at upload,
+// so the new samples come from the shard that was uploaded and not from the holder's copy.
+func (n *Node) refillStorageSamples(ctx context.Context, target challengeTarget) error {
+	shardHashes := target.tracked.Blocks[target.block].ShardHashes
+	if target.chunk.ShardIndex >= len(shardHashes) {
+		return fmt.Errorf("no shard hash tracked for chunk %s", target.chunk.ChunkId)
+	}
+	fetched, _, err := n.fetchChunk(ctx, n.newFetchScheduler(), target.chunk, verifyShardHash(target.chunk.ChunkId, shardHashes[target.chunk.ShardIndex]))
+	if err != nil {
+		return err
+	}
+	return n.recordShardSamples(target.tracked.Manifest.FileId, target.chunk.ChunkId, fetched.Shard)
+}
+
+func (n *Node) popStorageSample(fileId string, chunkId string) (*models.StorageSample, error) {
+	data, err := database.GetData(n.DB, "samples", sampleKey(fileId, chunkId))
+	if err != nil {
+		return nil, err
+	}
+	var samples []models.StorageSample
+	err = json.Unmarshal(data, &samples)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%w for chunk %s", ErrNoStorageSamples, chunkId)
+	}
+	sample := samples[len(samples)-1]
+	payload, err := json.Marshal(samples[:len(samples)-1])
+	if err != nil {
+		return nil, err
+	}
+	err = database.PutData(n.DB, "samples", sampleKey(fileId, chunkId), payload)
+	if err != nil {
+		return nil, err
+	}
+	return &sample, nil
+}
+
+func (n *Node) deleteStorageSamples(fileId string) error {
+	return database.DeleteKeysWithPrefix(n.DB, "samples", fileId+"/")
+}
+
+func sampleKey(fileId string, chunkId string) string {
+	return fileId + "/" + chunkId
+}
+
+func (n *Node) AnswerChallenge(r *http.Request) (*models.ChunkChallengeResponse, error) {
+	var challenge models.ChunkChallengeRequest
+	err := json.NewDecoder(r.Body).Decode(&challenge)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	message, err := json.Marshal(models.ChunkChallengeRequest{Address: challenge.Address, PublicKey: challenge.PublicKey, ChunkId: challenge.ChunkId,
+		Nonce: challenge.Nonce, Offset: challenge.Offset, Length: challenge.Length})
+	if err != nil {
+		return nil, err
+	}
+	check, err := crypto.VerifySignature(message, challenge.Signature, challenge.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !check {
+		return nil, fmt.Errorf("sender not verified")
+	}
+	chunk, err := database.GetData(n.DB, "chunks", challenge.ChunkId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrChunkNotFound, challenge.ChunkId)
+	}
+	var chunkRequest models.ChunkRequest
+	err = json.Unmarshal(chunk, &chunkRequest)
+	if err != nil {
+		return nil, err
+	}
+	// only the uploader checks its chunks: anyone else could use the proofs to read them
+	if !crypto.SamePublicKey(challenge.PublicKey, chunkRequest.PublicKey) {
+		return nil, fmt.Errorf("%w: chunk %s was not stored by the sender", ErrChunkForbidden, challenge.ChunkId)
+	}
+	if challenge.Length < min(minChallengeLength, len(chunkRequest.Shard)) {
+		return nil, fmt.Errorf("%w: challenge range of %d bytes is too short", ErrChunkForbidden, challenge.Length)
+	}
+	proof, err := storageProof(challenge.Nonce, chunkRequest.Shard, challenge.Offset, challenge.Length)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ChunkChallengeResponse{ChunkId: challenge.ChunkId, Proof: proof}, nil
+}
+
+func (n *Node) challengeNode(ctx context.Context, node string, chunkId string, sample *models.StorageSample) error {
+	return n.asOwner(func(publicKey []byte) error {
+		return n.challengeNodeAs(ctx, node, chunkId, sample, publicKey)
+	})
+}
+
+func (n *Node) challengeNodeAs(ctx context.Context, node string, chunkId string, sample *models.StorageSample, publicKey []byte) error {
+	challenge := models.ChunkChallengeRequest{Address: n.Address(), PublicKey: publicKey, ChunkId: chunkId,
+		Nonce: sample.Nonce, Offset: sample.Offset, Length: sample.Length}
+	jsonBytes, err := json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	signature, err := n.Keys.SignMessageAs(publicKey, jsonBytes)
+	if err != nil {
+		return err
+	}
+	challenge.Signature = signature
+	jsonBytes, err = json.Marshal(challenge)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/chunk/challenge", node), bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.HttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", ErrChunkForbidden, string(body))
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: chunk %s not stored", ErrProofFailed, chunkId)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	var response models.ChunkChallengeResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.ChunkId != chunkId || !bytes.Equal(response.Proof, sample.Proof) {
+		return fmt.Errorf("%w: wrong proof for chunk %s", ErrProofFailed, chunkId)
+	}
+	return nil
+}
+
+func (n *Node) ChallengeNodes(ctx context.Context) {
+	ticker := time.NewTicker(getDelay(n.Config.CronChallenge))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !n.Started() {
+				continue
+			}
+			n.challengeTrackedChunks(ctx)
+
+		case <-ctx.Done():
+			log.Println("[Challenge] - Context cancelled, stopping ticker")
+			return
+		}
+	}
+}
+
+func (n *Node) challengeTrackedChunks(ctx context.Context) {
+	trackedFiles, err := database.GetAllData(n.DB, "tracked")
+	if err != nil {
+		log.Println("[Challenge] - Error: ", err)
+		return
+	}
+	var targets []challengeTarget
+	for _, data := range trackedFiles {
+		tracked := &models.TrackedFile{}
+		err = json.Unmarshal(data, tracked)
+		if err != nil {
+			log.Println("[Challenge] - Error: ", err)
+			continue
+		}
+		for i, block := range tracked.Manifest.Split {
+			for _, chunk := range block.Chunks {
+				for _, node := range chunk.Nodes {
+					targets = append(targets, challengeTarget{tracked: tracked, block: i, chunk: chunk, node: node})
+				}
+			}
+		}
+	}
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	if len(targets) > n.Config.ChallengesPerRound {
+		targets = targets[:n.Config.ChallengesPerRound]
+	}
+
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+		fileId, chunkId := target.tracked.Manifest.FileId, target.chunk.ChunkId
+		sample, err := n.popStorageSample(fileId, chunkId)
+		if errors.Is(err, ErrNoStorageSamples) {
+			err = n.refillStorageSamples(ctx, target)
+			if err != nil {
+				log.Printf("[Challenge] - Chunk %s is no longer challenged, error drawing new samples: %v\n", chunkId, err)
+				continue
+			}
+			log.Printf("[Challenge] - New storage samples drawn for chunk %s\n", chunkId)
+			sample, err = n.popStorageSample(fileId, chunkId)
+		}
+		if err != nil {
+			log.Println("[Challenge] - Error: ", err)
+			continue
+		}
+		err = n.challengeNode(ctx, target.node, chunkId, sample)
+		if err != nil {
+			log.Printf("[Challenge] - Node %s failed the challenge for chunk %s: %v\n", target.node, chunkId, err)
+		}
+		// an unreachable node or a refused challenge says nothing about the chunk
+		if err == nil || errors.Is(err, ErrProofFailed) {
+			n.recordNodeResult(target.node, err == nil)
+		}
+		n.queueNodeReport(target.node, "challenge", err)
+	}
+	n.flushNodeReports()
+}
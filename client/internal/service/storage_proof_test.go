@@ -0,0 +1,47 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestStorageProof(t *testing.T) {
+	shard := bytes.Repeat([]byte("0123456789abcdef"), 8)
+	nonce := []byte("nonce")
+
+	proof, err := storageProof(nonce, shard, 16, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(append(append([]byte{}, nonce...), shard[16:48]...))
+	if !bytes.Equal(proof, want[:]) {
+		t.Fatal("proof is not the hash of the nonce and the range")
+	}
+
+	other, _ := storageProof([]byte("other"), shard, 16, 32)
+	if bytes.Equal(proof, other) {
+		t.Fatal("proof does not depend on the nonce")
+	}
+	altered := append([]byte{}, shard...)
+	altered[20] ^= 1
+	if proof, _ := storageProof(nonce, altered, 16, 32); bytes.Equal(proof, want[:]) {
+		t.Fatal("proof does not depend on the shard")
+	}
+
+	tests := []struct {
+		name           string
+		offset, length int
+	}{
+		{"negative offset", -1, 16},
+		{"empty range", 0, 0},
+		{"past the end", len(shard) - 8, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := storageProof(nonce, shard, tt.offset, tt.length); err == nil {
+				t.Fatal("range accepted")
+			}
+		})
+	}
+}
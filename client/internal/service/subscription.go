@@ -2,23 +2,24 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
-	"strconv"
+	"time"
 
-	"github.com/FraMan97/kairos/client/internal/config"
 	"github.com/FraMan97/kairos/client/internal/crypto"
 	"github.com/FraMan97/kairos/client/internal/models"
 )
 
-func SubscribeNode() error {
+func (n *Node) SubscribeNode() error {
 	log.Println("[Subscription] - Subscribe Kairos node...")
-	chosenServer := rand.Intn(len(config.BootStrapServers))
 	subscription := models.SubscriptionRequest{
-		Address:   config.OnionAddress + ":" + strconv.Itoa(config.Port),
-		PublicKey: config.PublicKey,
+		Address:   n.Address(),
+		PublicKey: n.Keys.PublicKey(),
+		Timestamp: time.Now().UnixNano(),
 	}
 
 	jsonBytes, err := json.Marshal(subscription)
@@ -26,7 +27,7 @@ func SubscribeNode() error {
 		return err
 	}
 
-	signature, err := crypto.SignMessage(jsonBytes)
+	signature, err := n.Keys.SignMessage(jsonBytes)
 	if err != nil {
 		return err
 	}
@@ -36,19 +37,67 @@ func SubscribeNode() error {
 	if err != nil {
 		return err
 	}
-	resp, err := config.HttpClient.Post(fmt.Sprintf("http://%s/subscribe", config.BootStrapServers[chosenServer]),
+
+	// every bootstrap server gets the heartbeat, so a node stays alive even if the
+	// servers have not synchronized yet
+	subscribed := 0
+	var lastErr error
+	for _, server := range n.Config.BootStrapServers {
+		err = n.postSubscription(server, jsonBytes)
+		if err != nil {
+			log.Printf("[Subscription] - Error subscribing to http://%s: %v\n", server, err)
+			lastErr = err
+			continue
+		}
+		subscribed++
+	}
+	if subscribed == 0 {
+		return fmt.Errorf("no bootstrap server reached: %v", lastErr)
+	}
+	log.Printf("[Subscription] - Node %s subscribed successfully to %d/%d bootstrap servers\n", crypto.Fingerprint(n.Keys.PublicKey()), subscribed, len(n.Config.BootStrapServers))
+	return nil
+}
+
+func (n *Node) postSubscription(server string, payload []byte) error {
+	resp, err := n.HttpClient().Post(fmt.Sprintf("http://%s/subscribe", server),
 		"application/json",
-		bytes.NewBuffer(jsonBytes))
+		bytes.NewBuffer(payload))
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode == 200 {
-		log.Printf("[Subscription] - Node subscribed successfully to http://%s!\n", config.BootStrapServers[chosenServer])
-		return nil
-	} else {
-		return fmt.Errorf("error with message: %v", resp.Body)
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
 	}
+	return nil
+}
+
+// Heartbeat re-signs the subscription with a fresh timestamp and re-posts it until the
+// context is cancelled. It waits for /start: before it the node has neither an onion
+// address nor a key pair.
+func (n *Node) Heartbeat(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(n.heartbeatDelay()):
+			if !n.Started() {
+				continue
+			}
+			err := n.SubscribeNode()
+			if err != nil {
+				log.Println("[Heartbeat] - Error: ", err)
+			}
+
+		case <-ctx.Done():
+			log.Println("[Heartbeat] - Context cancelled, stopping heartbeat")
+			return
+		}
+	}
+}
 
+// heartbeatDelay spreads the heartbeats of the nodes within +/-20% of CronHeartbeat.
+func (n *Node) heartbeatDelay() time.Duration {
+	base := time.Duration(n.Config.CronHeartbeat) * time.Second
+	return base*4/5 + time.Duration(rand.Int63n(int64(base)*2/5+1))
 }
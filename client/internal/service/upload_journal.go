@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+func (n *Node) createUploadJournal(fileManifest *models.FileManifest, blockSize int, options models.UploadOptions) error {
+	payload, err := json.Marshal(models.UploadJournal{Manifest: *fileManifest, BlockSize: blockSize, Options: options, CreatedAt: time.Now().UnixNano()})
+	if err != nil {
+		return err
+	}
+	return database.PutData(n.DB, "uploads", fileManifest.FileId, payload)
+}
+
+func (n *Node) GetUploadJournal(fileId string) (*models.UploadJournal, error) {
+	data, err := database.GetData(n.DB, "uploads", fileId)
+	if err != nil {
+		return nil, fmt.Errorf("no upload journal for file %s: %w", fileId, err)
+	}
+	var journal models.UploadJournal
+	err = json.Unmarshal(data, &journal)
+	if err != nil {
+		return nil, err
+	}
+	return &journal, nil
+}
+
+func (n *Node) DeleteUploadJournal(fileId string) error {
+	err := database.DeleteKeysWithPrefix(n.DB, "uploads", fileId+"/")
+	if err != nil {
+		return err
+	}
+	return database.DeleteKey(n.DB, "uploads", fileId)
+}
+
+// AbortUpload drops an upload that will not be resumed: the chunks already acknowledged
+// are deleted from their holders and the journal, with its block keys, is wiped.
+func (n *Node) AbortUpload(fileId string) error {
+	journal, err := n.GetUploadJournal(fileId)
+	if err != nil {
+		return err
+	}
+	journaledBlocks, err := n.getJournalBlocks(fileId)
+	if err != nil {
+		return err
+	}
+	placed := make(map[string][]string)
+	for _, block := range journaledBlocks {
+		for chunkId, nodes := range block.Acks {
+			placed[chunkId] = nodes
+		}
+	}
+	if n.Started() {
+		n.RollbackUpload(&journal.Manifest, placed)
+	}
+	return n.DeleteUploadJournal(fileId)
+}
+
+// cleanUploadJournals aborts the uploads left unfinished for more than UploadJournalTTL.
+func (n *Node) cleanUploadJournals() {
+	if !n.Started() {
+		return
+	}
+	data, err := database.GetAllData(n.DB, "uploads")
+	if err != nil {
+		log.Println("[Clean] - Error: ", err)
+		return
+	}
+	expiry := time.Now().Add(-n.Config.UploadJournalTTL).UnixNano()
+	for key, value := range data {
+		if strings.Contains(key, "/") {
+			continue
+		}
+		var journal models.UploadJournal
+		if json.Unmarshal(value, &journal) == nil && journal.CreatedAt > expiry {
+			continue
+		}
+		log.Printf("[Clean] - Upload %s abandoned, deleting its journal\n", key)
+		err = n.AbortUpload(key)
+		if err != nil {
+			log.Println("[Clean] - Error: ", err)
+		}
+	}
+}
+
+// newJournalBlock keeps what a resume needs to encode the block again. The AES key is
+// sealed with the node key: in clear, the database alone would open the file before its
+// release and without being one of its recipients.
+func (n *Node) newJournalBlock(block models.EncodedBlock) (models.UploadJournalBlock, error) {
+	sealedKey, err := n.Keys.SealLocal(block.AESKey)
+	if err != nil {
+		return models.UploadJournalBlock{}, err
+	}
+	return models.UploadJournalBlock{
+		Index:       block.Index,
+		SealedKey:   sealedKey,
+		Nonce:       block.Nonce,
+		KeyIndexes:  block.KeyIndexes,
+		KeyParts:    block.KeyParts,
+		ShardHashes: shardHashes(block.Shards),
+		Acks:        map[string][]string{},
+	}, nil
+}
+
+func (n *Node) putJournalBlock(fileId string, block models.UploadJournalBlock) error {
+	payload, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	return database.PutData(n.DB, "uploads", journalBlockKey(fileId, block.Index), payload)
+}
+
+func (n *Node) getJournalBlocks(fileId string) (map[int]models.UploadJournalBlock, error) {
+	data, err := database.GetDataWithPrefix(n.DB, "uploads", fileId+"/")
+	if err != nil {
+		return nil, err
+	}
+	blocks := make(map[int]models.UploadJournalBlock)
+	for _, v := range data {
+		var block models.UploadJournalBlock
+		err = json.Unmarshal(v, &block)
+		if err != nil {
+			return nil, err
+		}
+		blocks[block.Index] = block
+	}
+	return blocks, nil
+}
+
+func journalBlockKey(fileId string, blockIndex int) string {
+	return fileId + "/" + strconv.Itoa(blockIndex)
+}
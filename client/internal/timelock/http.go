@@ -0,0 +1,265 @@
+package timelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	chain "github.com/drand/drand/v2/common"
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+	"github.com/drand/tlock"
+	tlock_http "github.com/drand/tlock/networks/http"
+)
+
+const relayTimeout = 5 * time.Second
+
+var ErrNoRelay = errors.New("no Drand relay available")
+var ErrChainMismatch = errors.New("relay serves another chain")
+
+type relayHealth struct {
+	failures    int
+	lastFailure time.Time
+}
+
+type relayNetwork struct {
+	*tlock_http.Network
+	info *chaininfo.Info
+}
+
+type HTTPProvider struct {
+	relayList []string
+	chainHash string
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	health   map[string]*relayHealth
+	networks map[string]*relayNetwork
+}
+
+func NewHTTPProvider(relays []string, chainHash string, cooldown time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		relayList: relays,
+		chainHash: chainHash,
+		cooldown:  cooldown,
+		health:    make(map[string]*relayHealth),
+		networks:  make(map[string]*relayNetwork),
+	}
+}
+
+func (p *HTTPProvider) Network() (Network, error) {
+	network := &failoverNetwork{provider: p, chainHash: p.chainHash}
+	_, err := network.primary()
+	if err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+// relays returns the configured relays, the ones not cooling down after a failure first,
+// fewer consecutive failures first.
+func (p *HTTPProvider) relays() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	relays := append([]string(nil), p.relayList...)
+	now := time.Now()
+	cooling := func(relay string) bool {
+		h := p.health[relay]
+		return h != nil && h.failures > 0 && now.Before(h.lastFailure.Add(p.relayCooldown(h.failures)))
+	}
+	sort.SliceStable(relays, func(i, j int) bool {
+		ci, cj := cooling(relays[i]), cooling(relays[j])
+		if ci != cj {
+			return !ci
+		}
+		return p.failures(relays[i]) < p.failures(relays[j])
+	})
+	return relays
+}
+
+func (p *HTTPProvider) failures(relay string) int {
+	if h := p.health[relay]; h != nil {
+		return h.failures
+	}
+	return 0
+}
+
+func (p *HTTPProvider) relayCooldown(failures int) time.Duration {
+	cooldown := p.cooldown << (failures - 1)
+	if failures > 6 || cooldown > 30*time.Minute {
+		cooldown = 30 * time.Minute
+	}
+	return cooldown
+}
+
+func (p *HTTPProvider) markFailure(relay string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := p.health[relay]
+	if h == nil {
+		h = &relayHealth{}
+		p.health[relay] = h
+	}
+	h.failures++
+	h.lastFailure = time.Now()
+	log.Printf("[Drand] - Relay %s failed (%d in a row): %v\n", relay, h.failures, err)
+}
+
+func (p *HTTPProvider) markSuccess(relay string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.health, relay)
+}
+
+func (p *HTTPProvider) network(relay string, chainHash string) (*relayNetwork, error) {
+	key := relay + "/" + chainHash
+	p.mu.Lock()
+	network, ok := p.networks[key]
+	p.mu.Unlock()
+	if ok {
+		return network, nil
+	}
+
+	info, err := verifyChainInfo(relay, chainHash)
+	if err != nil {
+		return nil, err
+	}
+	tNetwork, err := tlock_http.NewNetwork(relay, chainHash)
+	if err != nil {
+		return nil, err
+	}
+	network = &relayNetwork{Network: tNetwork, info: info}
+
+	p.mu.Lock()
+	p.networks[key] = network
+	p.mu.Unlock()
+	return network, nil
+}
+
+func verifyChainInfo(relay string, chainHash string) (*chaininfo.Info, error) {
+	if !strings.HasPrefix(relay, "http") {
+		relay = "https://" + relay
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(relay, "/")+"/"+chainHash+"/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("chain info request returned status %d", resp.StatusCode)
+	}
+	info, err := chaininfo.InfoFromJSON(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if info.HashString() != chainHash {
+		return nil, fmt.Errorf("%w: %s instead of %s", ErrChainMismatch, info.HashString(), chainHash)
+	}
+	return info, nil
+}
+
+// failoverNetwork pins the chain hash and asks the relays in health order,
+// moving to the next one whenever a relay fails.
+type failoverNetwork struct {
+	provider  *HTTPProvider
+	chainHash string
+	current   *relayNetwork
+}
+
+func (n *failoverNetwork) primary() (*relayNetwork, error) {
+	if n.current != nil {
+		return n.current, nil
+	}
+	var lastErr error = ErrNoRelay
+	for _, relay := range n.provider.relays() {
+		network, err := n.provider.network(relay, n.chainHash)
+		if err != nil {
+			n.provider.markFailure(relay, err)
+			lastErr = err
+			continue
+		}
+		n.provider.markSuccess(relay)
+		n.current = network
+		return network, nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrNoRelay, lastErr)
+}
+
+func (n *failoverNetwork) ChainHash() string {
+	return n.chainHash
+}
+
+func (n *failoverNetwork) Current(date time.Time) uint64 {
+	return n.current.Current(date)
+}
+
+func (n *failoverNetwork) RoundTime(round uint64) time.Time {
+	return time.Unix(chain.TimeOfRound(n.current.info.Period, n.current.info.GenesisTime, round), 0)
+}
+
+func (n *failoverNetwork) PublicKey() kyber.Point {
+	return n.current.PublicKey()
+}
+
+func (n *failoverNetwork) Scheme() crypto.Scheme {
+	return n.current.Scheme()
+}
+
+func (n *failoverNetwork) Signature(roundNumber uint64) ([]byte, error) {
+	// a round in the future is refused by every relay, no need to ask them
+	if roundNumber > n.Current(time.Now()) {
+		return nil, tlock.ErrTooEarly
+	}
+	var lastErr error = ErrNoRelay
+	for _, relay := range n.provider.relays() {
+		// a relay that can't be reached or serves another chain fails here
+		network, err := n.provider.network(relay, n.chainHash)
+		if err != nil {
+			n.provider.markFailure(relay, err)
+			lastErr = err
+			continue
+		}
+		signature, err := network.Signature(roundNumber)
+		if err == nil {
+			n.provider.markSuccess(relay)
+			return signature, nil
+		}
+		lastErr = err
+		if !n.relayFault(roundNumber, err) {
+			lastErr = fmt.Errorf("%w: %v", tlock.ErrTooEarly, err)
+			continue
+		}
+		n.provider.markFailure(relay, err)
+	}
+	return nil, lastErr
+}
+
+// relayFault tells whether a relay that answered the round with err is at fault. Relays
+// publish a round a moment after it starts, so a missing current round only means it is
+// too early, as does a request cancelled by the caller.
+func (n *failoverNetwork) relayFault(roundNumber uint64, err error) bool {
+	if errors.Is(err, tlock.ErrTooEarly) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return roundNumber < n.Current(time.Now())
+}
+
+func (n *failoverNetwork) SwitchChainHash(chainHash string) error {
+	if chainHash != n.chainHash {
+		return fmt.Errorf("ciphertext uses the chain %s, configured chain is %s", chainHash, n.chainHash)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package timelock
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	chaininfo "github.com/drand/drand/v2/common/chain"
+	"github.com/drand/tlock"
+)
+
+func TestRelaysOrder(t *testing.T) {
+	p := NewHTTPProvider([]string{"a", "b", "c"}, "hash", time.Hour)
+	if got := p.relays(); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("healthy relays reordered: %v", got)
+	}
+
+	p.markFailure("a", errors.New("down"))
+	if got := p.relays(); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Fatalf("cooling relay not moved last: %v", got)
+	}
+
+	p.markFailure("b", errors.New("down"))
+	p.markFailure("b", errors.New("down"))
+	if got := p.relays(); !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Fatalf("cooling relays not ordered by failures: %v", got)
+	}
+
+	p.markSuccess("b")
+	if got := p.relays(); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Fatalf("relay still cooling after a success: %v", got)
+	}
+}
+
+func TestRelaysCooldownExpires(t *testing.T) {
+	p := NewHTTPProvider([]string{"a", "b"}, "hash", time.Nanosecond)
+	p.markFailure("a", errors.New("down"))
+	time.Sleep(time.Millisecond)
+	// out of the cooldown, a relay goes back in the rotation after the ones that never failed
+	if got := p.relays(); !slices.Equal(got, []string{"b", "a"}) {
+		t.Fatalf("unexpected order: %v", got)
+	}
+	p.markFailure("b", errors.New("down"))
+	p.markFailure("b", errors.New("down"))
+	time.Sleep(time.Millisecond)
+	if got := p.relays(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("relays not ordered by failures: %v", got)
+	}
+}
+
+func TestRelayCooldownBackoff(t *testing.T) {
+	p := NewHTTPProvider(nil, "hash", time.Minute)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 30 * time.Minute},
+		{60, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.relayCooldown(tt.failures); got != tt.want {
+			t.Errorf("relayCooldown(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestNetworkFailsOverEveryRelay(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	wrongChain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"public_key":"not a key"}`))
+	}))
+	defer wrongChain.Close()
+
+	p := NewHTTPProvider([]string{broken.URL, wrongChain.URL}, "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971", time.Hour)
+	_, err := p.Network()
+	if !errors.Is(err, ErrNoRelay) {
+		t.Fatalf("expected ErrNoRelay, got %v", err)
+	}
+	for _, relay := range []string{broken.URL, wrongChain.URL} {
+		if failures := p.failures(relay); failures != 1 {
+			t.Errorf("relay %s has %d failures, want 1", relay, failures)
+		}
+	}
+}
+
+const chainInfo = `{"public_key":"83cf0f2896adee7eb8b5f01fcad3912212c437e0073e911fb90022d3e760183c8c4b450b6a0a6c3ac6a5776a2d1064510d1fec758c921cc22b0e17e63aaf4bcb5ed66304de9cf809bd274ca73bab4af5a6e9c76a4bc09e76eae8991ef5ece45a","period":3,"genesis_time":1692803367,"genesis_seed":"f477d5c89f21a17c863a7f937c6a6d15859414d2be09cd448d4279af331c5d3e","schemeID":"bls-unchained-g1-rfc9380","metadata":{"beaconID":"quicknet"}}`
+
+func TestSignatureCountsOnlyRelayFaults(t *testing.T) {
+	info, err := chaininfo.InfoFromJSON(strings.NewReader(chainInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainHash := info.HashString()
+	// the relay serves the chain but has no rounds
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+chainHash+"/info" {
+			w.Write([]byte(chainInfo))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer relay.Close()
+
+	p := NewHTTPProvider([]string{relay.URL}, chainHash, time.Hour)
+	network, err := p.Network()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := network.Current(time.Now())
+
+	for _, round := range []uint64{current + 10, current} {
+		if _, err := network.Signature(round); !errors.Is(err, tlock.ErrTooEarly) {
+			t.Fatalf("round %d: expected ErrTooEarly, got %v", round, err)
+		}
+		if failures := p.failures(relay.URL); failures != 0 {
+			t.Fatalf("round %d not out yet counted as %d relay failures", round, failures)
+		}
+	}
+
+	if _, err := network.Signature(current - 10); err == nil || errors.Is(err, tlock.ErrTooEarly) {
+		t.Fatalf("expected a relay error for a past round, got %v", err)
+	}
+	if failures := p.failures(relay.URL); failures != 1 {
+		t.Fatalf("missing past round counted as %d relay failures, want 1", failures)
+	}
+}
@@ -0,0 +1,34 @@
+package timelock
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/FraMan97/kairos/client/internal/config"
+	"github.com/drand/tlock"
+)
+
+type Network interface {
+	tlock.Network
+	RoundTime(round uint64) time.Time
+}
+
+type TimeLockProvider interface {
+	Network() (Network, error)
+}
+
+func NewProvider(cfg *config.Config) (TimeLockProvider, error) {
+	switch cfg.TimeLockBackend {
+	case "drand":
+		return NewHTTPProvider(cfg.DrandRelays, cfg.DrandChainHash, cfg.DrandRelayCooldown), nil
+	case "local":
+		// the seed of the local beacon is public: with Tor the files would look time-locked
+		// to the other nodes while anyone can open them
+		if cfg.TransportBackend != "loopback" {
+			return nil, fmt.Errorf("the local time-lock backend needs the loopback transport")
+		}
+		return NewLocalProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown time-lock backend %q", cfg.TimeLockBackend)
+	}
+}
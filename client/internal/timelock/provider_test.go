@@ -0,0 +1,21 @@
+package timelock
+
+import (
+	"testing"
+
+	"github.com/FraMan97/kairos/client/internal/config"
+)
+
+func TestLocalBackendNeedsLoopback(t *testing.T) {
+	cfg := config.New(t.TempDir())
+	cfg.TimeLockBackend = "local"
+
+	cfg.TransportBackend = "tor"
+	if _, err := NewProvider(cfg); err == nil {
+		t.Fatal("local beacon accepted with the tor transport")
+	}
+	cfg.TransportBackend = "loopback"
+	if _, err := NewProvider(cfg); err != nil {
+		t.Fatalf("local beacon refused with the loopback transport: %v", err)
+	}
+}
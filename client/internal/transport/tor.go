@@ -1,9 +1,10 @@
-package service
+package transport
 
 import (
 	"bufio"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,19 +18,26 @@ import (
 	"golang.org/x/net/proxy"
 )
 
-func StartTor() (string, error) {
+// Tor makes the node reachable as an onion service and sends every outbound call
+// through the SOCKS port of the Tor process.
+type Tor struct {
+	cfg    *config.Config
+	client *http.Client
+}
+
+func (t *Tor) Start() (string, error) {
 	log.Println("[Tor] - Starting Tor...")
 
-	hiddenServiceDir := filepath.Join(config.TorDataDir, "hidden_service")
+	hiddenServiceDir := filepath.Join(t.cfg.TorDataDir, "hidden_service")
 
-	os.MkdirAll(config.TorDataDir, 0700)
+	os.MkdirAll(t.cfg.TorDataDir, 0700)
 	os.MkdirAll(hiddenServiceDir, 0700)
 
-	cmd := exec.Command(config.TorPath,
-		"--DataDirectory", config.TorDataDir,
+	cmd := exec.Command(t.cfg.TorPath,
+		"--DataDirectory", t.cfg.TorDataDir,
 		"--HiddenServiceDir", hiddenServiceDir,
-		"--SocksPort", strconv.Itoa(config.SocksPort),
-		"--HiddenServicePort", fmt.Sprintf("%d 127.0.0.1:%d", config.Port, config.Port),
+		"--SocksPort", strconv.Itoa(t.cfg.SocksPort),
+		"--HiddenServicePort", fmt.Sprintf("%d 127.0.0.1:%d", t.cfg.Port, t.cfg.Port),
 	)
 
 	stdout, _ := cmd.StdoutPipe()
@@ -80,8 +88,7 @@ func StartTor() (string, error) {
 	addr := strings.TrimSpace(string(onionAddr))
 	log.Println("[Tor] - Hidden service created!")
 	log.Printf("[Tor] - .onion address: http://%s\n", addr)
-	config.OnionAddress = addr
-	config.HttpClient, err = createClientTor()
+	t.client, err = createClientTor(t.cfg.SocksPort)
 	if err != nil {
 		log.Println("[Tor] - Error creating http client:", err)
 		return "", fmt.Errorf("error creating http client: %w", err)
@@ -89,8 +96,17 @@ func StartTor() (string, error) {
 	return addr, nil
 }
 
-func createClientTor() (*http.Client, error) {
-	torProxy, err := url.Parse(fmt.Sprintf("socks5://127.0.0.1:%s", strconv.Itoa(config.SocksPort)))
+func (t *Tor) Client() *http.Client {
+	return t.client
+}
+
+// Listen binds the loopback interface only: the peers come in through the hidden service.
+func (t *Tor) Listen(port int) (net.Listener, error) {
+	return net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+}
+
+func createClientTor(socksPort int) (*http.Client, error) {
+	torProxy, err := url.Parse(fmt.Sprintf("socks5://127.0.0.1:%s", strconv.Itoa(socksPort)))
 	if err != nil {
 		return nil, err
 	}
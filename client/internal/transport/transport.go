@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/FraMan97/kairos/client/internal/config"
+)
+
+// Transport is how a node is reached by the others and how it reaches them.
+type Transport interface {
+	// Start makes the node reachable and returns the host advertised to the others.
+	Start() (string, error)
+	// Client is used for every outbound call, once Start has returned.
+	Client() *http.Client
+	Listen(port int) (net.Listener, error)
+}
+
+func New(cfg *config.Config) (Transport, error) {
+	switch cfg.TransportBackend {
+	case "tor":
+		return &Tor{cfg: cfg}, nil
+	case "loopback":
+		return &Loopback{Host: cfg.AdvertiseHost}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q, use 'tor' or 'loopback'", cfg.TransportBackend)
+	}
+}
@@ -0,0 +1,132 @@
+// Package peer starts a storage node inside another program, for example the simulation
+// of the network. The k-client command serves the same node from the command line.
+package peer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/FraMan97/kairos/client/internal/api"
+	"github.com/FraMan97/kairos/client/internal/config"
+	"github.com/FraMan97/kairos/client/internal/models"
+	"github.com/FraMan97/kairos/client/internal/service"
+	"github.com/FraMan97/kairos/client/internal/timelock"
+	"github.com/FraMan97/kairos/client/internal/transport"
+)
+
+type Config = config.Config
+
+type Transport = transport.Transport
+
+type TimeLockProvider = timelock.TimeLockProvider
+
+type FileManifest = models.FileManifest
+
+type TrackedFile = models.TrackedFile
+
+// NewConfig returns the default settings of a node keeping its state under home.
+func NewConfig(home string) *Config {
+	return config.New(home)
+}
+
+// NewLocalTimeLock returns the in-process beacon standing in for Drand. Every node given
+// the same provider shares its chain.
+func NewLocalTimeLock() TimeLockProvider {
+	return timelock.NewLocalProvider()
+}
+
+type Node struct {
+	node     *service.Node
+	control  http.Handler
+	listener net.Listener
+}
+
+// Start unlocks the keystore of the node, serves the peer API with t and joins the
+// network as /start does. The control API is returned by Control, without a token.
+func Start(cfg *Config, passphrase string, t Transport, timeLock TimeLockProvider) (*Node, error) {
+	node, err := service.NewNode(cfg, t, timeLock)
+	if err != nil {
+		return nil, err
+	}
+	node.Keys.SetPassphrase(passphrase)
+	err = node.Keys.LoadOrCreateKeyPair()
+	if err != nil {
+		node.Close()
+		return nil, err
+	}
+
+	controller := api.NewController(node)
+	listener, err := t.Listen(cfg.Port)
+	if err != nil {
+		node.Close()
+		return nil, err
+	}
+	go http.Serve(listener, controller.PeerRoutes())
+
+	n := &Node{node: node, control: controller.ControlRoutes(), listener: listener}
+	rec := httptest.NewRecorder()
+	n.control.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/start", nil))
+	if rec.Code != http.StatusOK {
+		n.Stop()
+		return nil, fmt.Errorf("/start answered %d: %s", rec.Code, rec.Body.String())
+	}
+	return n, nil
+}
+
+// Control is the control API of the node, the one the CLI talks to.
+func (n *Node) Control() http.Handler {
+	return n.control
+}
+
+// Address is the address the others reach the node at.
+func (n *Node) Address() string {
+	return n.node.Address()
+}
+
+func (n *Node) Stop() error {
+	n.listener.Close()
+	return n.node.Close()
+}
+
+// Manifest downloads the manifest of a file from the bootstrap servers.
+func (n *Node) Manifest(fileId string) (*FileManifest, error) {
+	return n.node.GetFileManifestFromServer(fileId)
+}
+
+// PublishManifest signs the manifest with the current key and uploads it again.
+func (n *Node) PublishManifest(manifest *FileManifest) error {
+	return n.node.UploadFileManifest(manifest)
+}
+
+// RotateKey replaces the key of the node with a new one and retires the old one.
+func (n *Node) RotateKey() error {
+	newKey, err := service.GenerateKey()
+	if err != nil {
+		return err
+	}
+	return n.node.RotateKey(newKey)
+}
+
+// PublicKeys lists the current key of the node and the retired ones.
+func (n *Node) PublicKeys() [][]byte {
+	return n.node.Keys.PublicKeys()
+}
+
+// RequestChunk asks holder for a chunk as the owner does before the release.
+func (n *Node) RequestChunk(ctx context.Context, holder string, chunkId string) error {
+	_, err := n.node.RequestChunk(ctx, holder, chunkId)
+	return err
+}
+
+// DeleteChunks deletes the chunks placed on the holders, as a failed upload does.
+func (n *Node) DeleteChunks(manifest *FileManifest, placed map[string][]string) {
+	n.node.RollbackUpload(manifest, placed)
+}
+
+// RepairFile rebuilds the lost shards of a tracked file and places them on other nodes.
+func (n *Node) RepairFile(ctx context.Context, tracked *TrackedFile) error {
+	return n.node.RepairFile(ctx, tracked)
+}
@@ -0,0 +1,90 @@
+package peer
+
+import (
+	"encoding/json"
+
+	"github.com/FraMan97/kairos/client/internal/database"
+	"github.com/FraMan97/kairos/client/internal/models"
+)
+
+// The state of the node read and changed in place, for simulations that break a node
+// without going through the network.
+
+// TrackedFile is what the owner keeps about a file it uploaded.
+func (n *Node) TrackedFile(fileId string) (*TrackedFile, error) {
+	data, err := database.GetData(n.node.DB, "tracked", fileId)
+	if err != nil {
+		return nil, err
+	}
+	var tracked TrackedFile
+	err = json.Unmarshal(data, &tracked)
+	if err != nil {
+		return nil, err
+	}
+	return &tracked, nil
+}
+
+// Shard returns the shard of a chunk the node holds.
+func (n *Node) Shard(chunkId string) ([]byte, error) {
+	chunk, err := n.chunk(chunkId)
+	if err != nil {
+		return nil, err
+	}
+	return chunk.Shard, nil
+}
+
+// ReplaceShard swaps the shard of a chunk the node holds, leaving its owner unchanged.
+func (n *Node) ReplaceShard(chunkId string, shard []byte) error {
+	chunk, err := n.chunk(chunkId)
+	if err != nil {
+		return err
+	}
+	chunk.Shard = shard
+	payload, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	return database.PutData(n.node.DB, "chunks", chunkId, payload)
+}
+
+func (n *Node) chunk(chunkId string) (*models.ChunkRequest, error) {
+	data, err := database.GetData(n.node.DB, "chunks", chunkId)
+	if err != nil {
+		return nil, err
+	}
+	var chunk models.ChunkRequest
+	err = json.Unmarshal(data, &chunk)
+	if err != nil {
+		return nil, err
+	}
+	return &chunk, nil
+}
+
+// DeleteChunk loses a chunk the node holds.
+func (n *Node) DeleteChunk(chunkId string) error {
+	return database.DeleteKey(n.node.DB, "chunks", chunkId)
+}
+
+// WipeChunks loses every chunk the node holds.
+func (n *Node) WipeChunks() error {
+	return database.DeleteKeysWithPrefix(n.node.DB, "chunks", "")
+}
+
+// StorageSamples counts the storage samples the owner has left for a chunk.
+func (n *Node) StorageSamples(fileId string, chunkId string) (int, error) {
+	data, err := database.GetData(n.node.DB, "samples", fileId+"/"+chunkId)
+	if err != nil {
+		return 0, err
+	}
+	var samples []models.StorageSample
+	err = json.Unmarshal(data, &samples)
+	if err != nil {
+		return 0, err
+	}
+	return len(samples), nil
+}
+
+// UseStorageSamples drops the storage samples the owner has left for a chunk.
+func (n *Node) UseStorageSamples(fileId string, chunkId string) error {
+	return database.PutData(n.node.DB, "samples", fileId+"/"+chunkId, []byte("[]"))
+}
@@ -0,0 +1,104 @@
+// Package bootstrap starts a bootstrap server. The k-server command runs it from the
+// command line, other programs such as the simulation run it in process.
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/FraMan97/kairos/server/internal/api"
+	"github.com/FraMan97/kairos/server/internal/bearer"
+	"github.com/FraMan97/kairos/server/internal/config"
+	"github.com/FraMan97/kairos/server/internal/service"
+	"github.com/FraMan97/kairos/server/internal/transport"
+)
+
+type Config = config.Config
+
+type Transport = transport.Transport
+
+// NewConfig returns the default settings of a server keeping its state under home.
+func NewConfig(home string) *Config {
+	return config.New(home)
+}
+
+type Server struct {
+	server   *service.Server
+	listener net.Listener
+	cancel   context.CancelFunc
+	served   chan error
+}
+
+// Start unlocks the keystore of the server, makes it reachable with t and serves the
+// bootstrap API until Stop is called.
+func Start(cfg *Config, passphrase string, t Transport) (*Server, error) {
+	server, err := service.NewServer(cfg, t)
+	if err != nil {
+		return nil, err
+	}
+	server.Keys.SetPassphrase(passphrase)
+
+	_, err = server.StartTransport()
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	err = server.Keys.LoadOrCreateKeyPair()
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	operatorToken, err := bearer.LoadOrCreate(cfg.OperatorTokenFile, "operator")
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	listener, err := t.Listen(cfg.Port)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.ServerBootstrapSync(ctx)
+	go server.CleanOldRecords(ctx)
+	go server.ExpireNodes(ctx)
+
+	served := make(chan error, 1)
+	go func() {
+		err := http.Serve(listener, api.NewController(server, operatorToken).Routes())
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Println("[Bootstrap] - Error serving: ", err)
+		} else {
+			err = nil
+		}
+		served <- err
+	}()
+
+	return &Server{server: server, listener: listener, cancel: cancel, served: served}, nil
+}
+
+// Wait blocks until the server stops serving, and returns the error that stopped it,
+// nil after Stop.
+func (s *Server) Wait() error {
+	return <-s.served
+}
+
+// ListenAddr is the local address the API is served on.
+func (s *Server) ListenAddr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Address is the address the nodes reach the server at.
+func (s *Server) Address() string {
+	return s.server.Address()
+}
+
+func (s *Server) Stop() error {
+	s.cancel()
+	s.listener.Close()
+	return s.server.Close()
+}
@@ -1,95 +1,80 @@
 package main
 
 import (
-	"context"
 	"flag"
-	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
 
-	"github.com/FraMan97/kairos/server/internal/api"
+	"github.com/FraMan97/kairos/server/bootstrap"
 	"github.com/FraMan97/kairos/server/internal/config"
 	"github.com/FraMan97/kairos/server/internal/crypto"
-	"github.com/FraMan97/kairos/server/internal/database"
-	"github.com/FraMan97/kairos/server/internal/service"
+	"github.com/FraMan97/kairos/server/internal/transport"
 )
 
 func main() {
-	bootstrapPtr := flag.String("bootstrap-servers", "", "bootstrap servers's .onion address (use the comma separator if many)")
-	noBootstrapPtr := flag.Bool("no-bootstrap-servers", false, "Start the bootstrap server without other bootstrap servers (standalone mode)")
-	flag.Parse()
-
-	if err := config.InitConfig(); err != nil {
+	cfg, err := config.InitConfig()
+	if err != nil {
 		log.Println("[Config] - Error initializing config: ", err)
 		os.Exit(1)
 	}
 
+	bootstrapPtr := flag.String("bootstrap-servers", "", "bootstrap servers's .onion address (use the comma separator if many)")
+	noBootstrapPtr := flag.Bool("no-bootstrap-servers", false, "Start the bootstrap server without other bootstrap servers (standalone mode)")
+	nodeTTLPtr := flag.Int("node-ttl", cfg.NodeTTL, "Seconds without a heartbeat after which a node is considered gone")
+	passphraseFilePtr := flag.String("passphrase-file", "", "File holding the passphrase of the keystore (default: the "+crypto.PassphraseEnv+" environment variable)")
+	passphraseFdPtr := flag.Int("passphrase-fd", -1, "File descriptor to read the passphrase of the keystore from")
+	transportPtr := flag.String("transport", cfg.TransportBackend, "Transport between the nodes: 'tor' for onion services or 'loopback' for plain TCP (local tests, no anonymity)")
+	advertiseHostPtr := flag.String("advertise-host", cfg.AdvertiseHost, "Host the loopback transport listens on and advertises to the others")
+	portPtr := flag.Int("port", cfg.Port, "Port of the bootstrap server")
+	flag.Parse()
+
 	if *bootstrapPtr != "" {
-		config.BootStrapServers = strings.Split(*bootstrapPtr, ",")
-		log.Println("[Config] - Bootstrap Servers set using flag: ", config.BootStrapServers)
+		cfg.BootStrapServers = strings.Split(*bootstrapPtr, ",")
+		log.Println("[Config] - Bootstrap Servers set using flag: ", cfg.BootStrapServers)
 	} else if *noBootstrapPtr {
-		config.BootStrapServers = []string{}
+		cfg.BootStrapServers = []string{}
 		log.Println("[Config] - Mode 'standalone' activated")
-	} else if len(config.BootStrapServers) == 0 {
+	} else if len(cfg.BootStrapServers) == 0 {
 		log.Println("[Config] - No Boostrap Servers set. Set using --bootstrap-servers flag")
 		os.Exit(1)
 	}
 
-	ctx, _ := context.WithCancel(context.Background())
-
-	_, err := service.StartTor()
-	if err != nil {
-		log.Println("[Main] - Starting error Tor: ", err)
+	if *nodeTTLPtr <= 0 {
+		log.Println("[Config] - The node TTL must be positive")
 		os.Exit(1)
 	}
+	cfg.NodeTTL = *nodeTTLPtr
 
-	err = crypto.GenerateKeyPair()
+	cfg.TransportBackend = *transportPtr
+	cfg.AdvertiseHost = *advertiseHostPtr
+	serverTransport, err := transport.New(cfg)
 	if err != nil {
-		log.Println("[Main] - Generation key pair error: ", err)
+		log.Println("[Config] - Error selecting the transport: ", err)
 		os.Exit(1)
 	}
-
-	_, err = database.OpenDatabase()
-	if err != nil {
-		log.Println("[Main] - Error opening database: ", err)
-		os.Exit(1)
+	if cfg.TransportBackend == "loopback" {
+		log.Println("[Config] - Using the loopback transport, the traffic does NOT go through Tor")
 	}
+	cfg.Port = *portPtr
 
-	err = database.EnsureBucket(config.BoltDB, "active_nodes")
+	passphrase, err := crypto.ReadPassphrase(*passphraseFilePtr, *passphraseFdPtr)
 	if err != nil {
-		log.Println("[Main] - Error creating bucket 'active_nodes': ", err)
+		log.Println("[Config] - Error reading the keystore passphrase: ", err)
 		os.Exit(1)
 	}
 
-	err = database.EnsureBucket(config.BoltDB, "manifests")
+	server, err := bootstrap.Start(cfg, passphrase, serverTransport)
 	if err != nil {
-		log.Println("[Main] - Error creating bucket 'manifests': ", err)
+		log.Println("[Main] - Error starting the server: ", err)
 		os.Exit(1)
 	}
+	defer server.Stop()
+	log.Printf("[Main] - The bootstrap server is listening to %s\n", server.ListenAddr())
 
-	go service.ServerBootstrapSync(ctx)
-
-	go service.CleanOldRecords(ctx)
-
-	http.HandleFunc("/subscribe", api.SubsribeNode)
-
-	http.HandleFunc("/synchronize", api.SynchronizeData)
-
-	http.HandleFunc("/file/nodes", api.RequestNodesForFileUpload)
-
-	http.HandleFunc("/file/manifest", api.InsertFileManifest)
-
-	http.HandleFunc("/manifests", api.DownloadFileManifest)
-
-	log.Printf("[Main] - The bootstrap server is listening to localhost:%s\n", strconv.Itoa(config.Port))
-
-	err = http.ListenAndServe(fmt.Sprintf(":%d", config.Port), nil)
+	err = server.Wait()
 	if err != nil {
 		log.Println("[Main] - Error Listening: ", err)
 		os.Exit(1)
 	}
-
 }
@@ -5,9 +5,12 @@ go 1.24.0
 toolchain go1.24.10
 
 require (
-	github.com/FraMan97/kairos v0.0.0-20251201004542-9a4437437e62
+	filippo.io/age v1.1.1
 	github.com/boltdb/bolt v1.3.1
 	golang.org/x/net v0.47.0
 )
 
-require golang.org/x/sys v0.38.0 // indirect
+require (
+	golang.org/x/crypto v0.44.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+)
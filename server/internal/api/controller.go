@@ -3,21 +3,19 @@ package api
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"log"
 	"math"
-	"math/rand"
 	"net/http"
-	"strconv"
 	"time"
 
-	"github.com/FraMan97/kairos/server/internal/config"
 	"github.com/FraMan97/kairos/server/internal/crypto"
 	"github.com/FraMan97/kairos/server/internal/database"
 	"github.com/FraMan97/kairos/server/internal/models"
 	"github.com/FraMan97/kairos/server/internal/service"
 )
 
-func SubsribeNode(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) SubsribeNode(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		log.Println("[Subscribe] - Only POST method allowed!")
 		http.Error(w, "Only POST Method allowed!", http.StatusMethodNotAllowed)
@@ -36,7 +34,14 @@ func SubsribeNode(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	message, err := json.Marshal(models.SubscriptionRequest{Address: subscription.Address, PublicKey: subscription.PublicKey})
+	// the signed timestamp keeps a captured heartbeat from being replayed to keep a node alive
+	if !c.server.WithinClockSkew(subscription.Timestamp, time.Now()) {
+		log.Printf("[Subscribe] - Subscription of %s expired or dated in the future\n", subscription.Address)
+		http.Error(w, "Subscription expired", http.StatusUnauthorized)
+		return
+	}
+
+	message, err := json.Marshal(models.SubscriptionRequest{Address: subscription.Address, PublicKey: subscription.PublicKey, Timestamp: subscription.Timestamp})
 	if err != nil {
 		log.Println("[Subscribe] - Invalid serialization:", err)
 		http.Error(w, "Invalid serialization", http.StatusBadRequest)
@@ -56,12 +61,16 @@ func SubsribeNode(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Error preparing payload", http.StatusInternalServerError)
 			return
 		}
-		err = database.PutData(config.BoltDB, "active_nodes", subscription.Address, payload)
+		err = database.PutData(c.server.DB, "active_nodes", subscription.Address, payload)
 		if err != nil {
 			log.Println("[Subscribe] - Error inserting data:", err)
 			http.Error(w, "Error inserting data", http.StatusInternalServerError)
 			return
 		}
+		err = c.server.RecordSubscription(subscription.Address, subscription.PublicKey)
+		if err != nil {
+			log.Println("[Subscribe] - Error updating the node reputation:", err)
+		}
 	} else {
 		http.Error(w, "Sender not verified", http.StatusUnauthorized)
 		return
@@ -69,7 +78,7 @@ func SubsribeNode(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func SynchronizeData(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) SynchronizeData(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		log.Println("[Sync] - Only POST method allowed!")
 		http.Error(w, "Only POST Method allowed!", http.StatusMethodNotAllowed)
@@ -89,7 +98,8 @@ func SynchronizeData(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	message, err := json.Marshal(models.SynchronizationRequest{Address: receivedData.Address, PublicKey: receivedData.PublicKey,
-		ActiveNodes: receivedData.ActiveNodes, FileManifests: receivedData.FileManifests})
+		ActiveNodes: receivedData.ActiveNodes, FileManifests: receivedData.FileManifests, Tombstones: receivedData.Tombstones,
+		KeyRotations: receivedData.KeyRotations})
 	if err != nil {
 		log.Println("[Sync] - Invalid serialization:", err)
 		http.Error(w, "Invalid serialization", http.StatusBadRequest)
@@ -104,22 +114,36 @@ func SynchronizeData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if check {
-		activeNodes, err := database.GetAllData(config.BoltDB, "active_nodes")
+		activeNodes, err := database.GetAllData(c.server.DB, "active_nodes")
 		if err != nil {
 			log.Println("[Sync] - Error get all data from bucket 'active_nodes':", err)
 			http.Error(w, "Error get all data from bucket 'active_nodes'", http.StatusInternalServerError)
 			return
 		}
 
-		fileManifests, err := database.GetAllData(config.BoltDB, "manifests")
+		fileManifests, err := database.GetAllData(c.server.DB, "manifests")
 		if err != nil {
 			log.Println("[Sync] - Error get all data from bucket 'manifests':", err)
 			http.Error(w, "Error get all data manifests", http.StatusInternalServerError)
 			return
 		}
 
-		dataToExchange := models.SynchronizationRequest{Address: config.OnionAddress + strconv.Itoa(config.Port), PublicKey: config.PublicKey,
-			ActiveNodes: activeNodes, FileManifests: fileManifests}
+		tombstones, err := database.GetAllData(c.server.DB, "tombstones")
+		if err != nil {
+			log.Println("[Sync] - Error get all data from bucket 'tombstones':", err)
+			http.Error(w, "Error get all data tombstones", http.StatusInternalServerError)
+			return
+		}
+
+		keyRotations, err := database.GetAllData(c.server.DB, "key_rotations")
+		if err != nil {
+			log.Println("[Sync] - Error get all data from bucket 'key_rotations':", err)
+			http.Error(w, "Error get all data key rotations", http.StatusInternalServerError)
+			return
+		}
+
+		dataToExchange := models.SynchronizationRequest{Address: c.server.Address(), PublicKey: c.server.Keys.PublicKey(),
+			ActiveNodes: activeNodes, FileManifests: fileManifests, Tombstones: tombstones, KeyRotations: keyRotations}
 
 		jsonBytes, err := json.Marshal(dataToExchange)
 		if err != nil {
@@ -128,7 +152,7 @@ func SynchronizeData(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		signature, err := crypto.SignMessage(jsonBytes)
+		signature, err := c.server.Keys.SignMessage(jsonBytes)
 		if err != nil {
 			log.Println("[Sync] - Error signing message:", err)
 			http.Error(w, "Error signing message", http.StatusBadRequest)
@@ -143,7 +167,7 @@ func SynchronizeData(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		go service.ProcessAlignment(dataToExchange, receivedData)
+		go c.server.ProcessAlignment(dataToExchange, receivedData)
 
 		w.Write(jsonBytes)
 	} else {
@@ -153,7 +177,7 @@ func SynchronizeData(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func RequestNodesForFileUpload(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) RequestNodesForFileUpload(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if r.Method != http.MethodPost {
 		log.Println("[ReqNodes] - Only POST method allowed!")
@@ -187,7 +211,7 @@ func RequestNodesForFileUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if check {
-		allDBNodes, err := database.GetAllKeys(config.BoltDB, "active_nodes")
+		allDBNodes, err := c.server.GetAliveNodes()
 		if err != nil {
 			log.Println("[ReqNodes] - Error get all data from bucket 'active_nodes':", err)
 			http.Error(w, "Error get all data from bucket 'active_nodes'", http.StatusInternalServerError)
@@ -199,10 +223,10 @@ func RequestNodesForFileUpload(w http.ResponseWriter, r *http.Request) {
 		if len(allDBNodes) <= nodesToPickup {
 			response = append(response, allDBNodes...)
 		} else {
-			if nodesToPickup > config.MaxNodesReturned {
-				response = pickRandomItems(allDBNodes, config.MaxNodesReturned)
+			if nodesToPickup > c.server.Config.MaxNodesReturned {
+				response = c.server.PickReliableNodes(allDBNodes, c.server.Config.MaxNodesReturned)
 			} else {
-				response = pickRandomItems(allDBNodes, nodesToPickup)
+				response = c.server.PickReliableNodes(allDBNodes, nodesToPickup)
 			}
 		}
 		jsonBytes, err := json.Marshal(response)
@@ -219,7 +243,7 @@ func RequestNodesForFileUpload(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func InsertFileManifest(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) InsertFileManifest(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if r.Method != http.MethodPost {
 		log.Println("[InsFileManifest] - Only POST method allowed!")
@@ -255,8 +279,25 @@ func InsertFileManifest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if check {
-		err = database.PutData(config.BoltDB, "manifests", fileManifest.FileId, manifestBytes)
-		if err != nil {
+		err = c.server.InsertFileManifest(fileManifest, manifestBytes, request.PublicKey, request.Signature)
+		switch {
+		case errors.Is(err, service.ErrManifestRevoked):
+			log.Printf("[InsFileManifest] - Manifest %s has been revoked\n", fileManifest.FileId)
+			http.Error(w, "Manifest revoked", http.StatusGone)
+			return
+		case errors.Is(err, service.ErrNotBoundToPublisher):
+			log.Printf("[InsFileManifest] - FileId %s not bound to the key of the sender\n", fileManifest.FileId)
+			http.Error(w, "FileId not bound to the key of the sender", http.StatusForbidden)
+			return
+		case errors.Is(err, service.ErrNotManifestOwner):
+			log.Printf("[InsFileManifest] - Manifest %s already published by another node\n", fileManifest.FileId)
+			http.Error(w, "Manifest already published by another node", http.StatusConflict)
+			return
+		case errors.Is(err, service.ErrManifestOutdated):
+			log.Printf("[InsFileManifest] - Manifest %s older than the published one\n", fileManifest.FileId)
+			http.Error(w, "Manifest older than the published one", http.StatusConflict)
+			return
+		case err != nil:
 			log.Println("[InsFileManifest] - Error inserting data in bucket 'manifests':", err)
 			http.Error(w, "Error inserting data in bucket 'manifests'", http.StatusInternalServerError)
 			return
@@ -269,7 +310,7 @@ func InsertFileManifest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func DownloadFileManifest(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DownloadFileManifest(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if r.Method != http.MethodPost {
 		log.Println("[DowFileManifest] - Only POST method allowed!")
@@ -303,12 +344,13 @@ func DownloadFileManifest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if check {
-		dbData, err := database.GetData(config.BoltDB, "manifests", request.FileId)
+		dbData, err := database.GetData(c.server.DB, "manifests", request.FileId)
 		if err != nil {
 			log.Println("[DowFileManifest] - Error get manifest from DB: ", err)
 			http.Error(w, "Error get manifestfrom DB", http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
 		w.Write(dbData)
 	} else {
 		http.Error(w, "Sender not verified", http.StatusUnauthorized)
@@ -317,20 +359,142 @@ func DownloadFileManifest(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func pickRandomItems(list []string, n int) []string {
-	selected := make([]string, 0, n)
+func (c *Controller) DeleteFileManifest(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		log.Println("[DelFileManifest] - Only POST method allowed!")
+		http.Error(w, "Only POST Method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.RevokeFileManifestRequest
 
-	if n > len(list) {
-		n = len(list)
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("[DelFileManifest] - Invalid JSON:", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
 	}
+	log.Printf("[DelFileManifest] - Received request from %s \n", request.Address)
 
-	for i := 0; i < n; i++ {
-		randomIndex := rand.Intn(len(list))
-		selected = append(selected, list[randomIndex])
+	check, err := service.VerifyRevokeRequest(request)
+	if err != nil {
+		log.Println("[DelFileManifest] - Invalid verification signature:", err)
+		http.Error(w, "Invalid verification signature", http.StatusBadRequest)
+		return
+	}
+
+	if check {
+		err = c.server.RevokeFileManifest(request)
+		if err != nil {
+			log.Println("[DelFileManifest] - Error revoking manifest: ", err)
+			http.Error(w, "Error revoking manifest", http.StatusForbidden)
+			return
+		}
+		log.Printf("[DelFileManifest] - Manifest %s revoked\n", request.FileId)
+		w.WriteHeader(http.StatusOK)
+	} else {
+		http.Error(w, "Sender not verified", http.StatusUnauthorized)
+		return
+	}
+}
 
-		list[randomIndex] = list[len(list)-1]
-		list = list[:len(list)-1]
+func (c *Controller) ReportNodes(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		log.Println("[ReportNodes] - Only POST method allowed!")
+		http.Error(w, "Only POST Method allowed!", http.StatusMethodNotAllowed)
+		return
 	}
 
-	return selected
+	var request models.NodeReportRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("[ReportNodes] - Invalid JSON:", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	log.Printf("[ReportNodes] - Received %d reports from %s\n", len(request.Reports), request.Address)
+
+	message, err := json.Marshal(models.NodeReportRequest{Address: request.Address, PublicKey: request.PublicKey, Reports: request.Reports})
+	if err != nil {
+		log.Println("[ReportNodes] - Invalid serialization:", err)
+		http.Error(w, "Invalid serialization", http.StatusBadRequest)
+		return
+	}
+
+	check, err := crypto.VerifySignature(message, request.Signature, request.PublicKey)
+	if err != nil {
+		log.Println("[ReportNodes] - Invalid verification signature:", err)
+		http.Error(w, "Invalid verification signature", http.StatusBadRequest)
+		return
+	}
+
+	// only subscribed nodes can report, so a report always traces back to a known key
+	if !check || !c.server.IsSubscribedNode(request.Address, request.PublicKey) {
+		http.Error(w, "Sender not verified", http.StatusUnauthorized)
+		return
+	}
+
+	applied, err := c.server.RecordNodeReports(request.Address, request.PublicKey, request.Reports)
+	if err != nil {
+		log.Println("[ReportNodes] - Error recording the reports:", err)
+		http.Error(w, "Error recording the reports", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[ReportNodes] - %d/%d reports from %s applied\n", applied, len(request.Reports), request.Address)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *Controller) GetNodeReputations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		log.Println("[Reputation] - Only GET method allowed!")
+		http.Error(w, "Only GET Method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reputations, err := c.server.GetNodeReputations()
+	if err != nil {
+		log.Println("[Reputation] - Error get all data from bucket 'reputation':", err)
+		http.Error(w, "Error get all data from bucket 'reputation'", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reputations)
+}
+
+func (c *Controller) RotateKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		log.Println("[RotateKey] - Only POST method allowed!")
+		http.Error(w, "Only POST Method allowed!", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.KeyRotationRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		log.Println("[RotateKey] - Invalid JSON:", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	log.Printf("[RotateKey] - Received request from %s\n", request.Address)
+
+	err = service.VerifyKeyRotation(request)
+	if err != nil {
+		log.Println("[RotateKey] - Invalid verification signature:", err)
+		http.Error(w, "Sender not verified", http.StatusUnauthorized)
+		return
+	}
+
+	err = c.server.ApplyKeyRotation(request)
+	if err != nil {
+		log.Println("[RotateKey] - Error applying the rotation:", err)
+		http.Error(w, "Error applying the rotation", http.StatusConflict)
+		return
+	}
+	log.Printf("[RotateKey] - Key %s of %s rotated to %s\n", crypto.Fingerprint(request.OldPublicKey), request.Address, crypto.Fingerprint(request.NewPublicKey))
+	w.WriteHeader(http.StatusOK)
 }
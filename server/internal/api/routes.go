@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/FraMan97/kairos/server/internal/bearer"
+	"github.com/FraMan97/kairos/server/internal/service"
+)
+
+type Controller struct {
+	server        *service.Server
+	operatorToken string
+}
+
+func NewController(server *service.Server, operatorToken string) *Controller {
+	return &Controller{server: server, operatorToken: operatorToken}
+}
+
+func (c *Controller) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/subscribe", c.SubsribeNode)
+
+	mux.HandleFunc("/synchronize", c.SynchronizeData)
+
+	mux.HandleFunc("/file/nodes", c.RequestNodesForFileUpload)
+
+	mux.HandleFunc("/file/manifest", c.InsertFileManifest)
+
+	mux.HandleFunc("/file/manifest/delete", c.DeleteFileManifest)
+
+	mux.HandleFunc("/manifests", c.DownloadFileManifest)
+
+	mux.HandleFunc("/nodes/report", c.ReportNodes)
+
+	mux.HandleFunc("/keys/rotate", c.RotateKey)
+
+	// the scores are for the operator only, the peers never read them
+	mux.Handle("/nodes/reputation", bearer.Require(c.operatorToken, "operator", http.HandlerFunc(c.GetNodeReputations)))
+
+	return mux
+}
@@ -0,0 +1,62 @@
+// Package bearer holds the bearer token guarding the operator endpoints of the server.
+// The client keeps the same helper for its control API.
+package bearer
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadOrCreate returns the token stored in path. The token is generated on the first run
+// and written to path, readable only by the user, where the tools using the API pick it up.
+// name only tells the tokens apart in the logs and the errors.
+func LoadOrCreate(path string, name string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		token := strings.TrimSpace(string(data))
+		if token != "" {
+			return token, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("error reading %s token: %w", name, err)
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(path, []byte(token+"\n"), 0600)
+	if err != nil {
+		return "", fmt.Errorf("error saving %s token: %w", name, err)
+	}
+	log.Printf("[Token] - New %s token written to %s\n", name, path)
+	return token, nil
+}
+
+// Require guards next: every request must carry token as its bearer token. An empty
+// token refuses every request.
+func Require(token string, name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			log.Printf("[Token] - Request to %s refused: missing or wrong %s token\n", r.URL.Path, name)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Missing or wrong "+name+" token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
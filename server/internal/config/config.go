@@ -1,46 +1,83 @@
 package config
 
 import (
-	"net/http"
 	"os"
 	"path/filepath"
-
-	"github.com/boltdb/bolt"
 )
 
-var (
-	OnionAddress string
-	HttpClient   *http.Client
-	PublicKey    []byte
-	PrivateKey   []byte
-	BoltDB       *bolt.DB
-
-	Port             int      = 3000
-	SocksPort        int      = 9051
-	BootStrapServers []string = []string{}
-	CronSync         int      = 10
-	CronClean        int      = 3600
-	MaxNodesReturned int      = 50
-	DatabaseService           = "BoltDB"
-
-	TorPath       string
-	TorDataDir    string
-	PrivateKeyDir string
-	PublicKeyDir  string
-)
+const DatabaseService = "BoltDB"
 
-func InitConfig() error {
+// Config holds the settings of one bootstrap server. Every server has its own, so several
+// of them can run in the same process.
+type Config struct {
+	Port              int
+	SocksPort         int
+	BootStrapServers  []string
+	CronSync          int
+	CronClean         int
+	CronExpire        int
+	NodeTTL           int
+	MaxClockSkew      int
+	MaxNodesReturned  int
+	MaxRefreshGap     int
+	UptimePrior       int
+	MinNodeWeight     float64
+	MaxReportsPerReq  int
+	ReportWindow      int
+	MaxReporterWeight int
+	ReporterUptime    int
+	ReputationTTL     int
+
+	TorPath            string
+	TorDataDir         string
+	DatabaseDir        string
+	PrivateKeyDir      string
+	PlainPrivateKeyDir string
+	PublicKeyDir       string
+	OperatorTokenFile  string
+	TransportBackend   string
+	AdvertiseHost      string
+}
+
+func InitConfig() (*Config, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return New(home), nil
+}
 
+// New returns the default settings of a server keeping its state under home.
+func New(home string) *Config {
 	baseDir := filepath.Join(home, ".kairos", "server")
 
-	TorPath = filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor", "tor")
-	TorDataDir = filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor_data")
-	PrivateKeyDir = filepath.Join(baseDir, "keys", "private_key.pem")
-	PublicKeyDir = filepath.Join(baseDir, "keys", "public_key.pem")
+	return &Config{
+		Port:              3000,
+		SocksPort:         9051,
+		BootStrapServers:  []string{},
+		CronSync:          10,
+		CronClean:         3600,
+		CronExpire:        60,
+		NodeTTL:           900,
+		MaxClockSkew:      300,
+		MaxNodesReturned:  50,
+		MaxRefreshGap:     1800,
+		UptimePrior:       3600,
+		MinNodeWeight:     0.05,
+		MaxReportsPerReq:  200,
+		ReportWindow:      600,
+		MaxReporterWeight: 10,
+		ReporterUptime:    7 * 24 * 3600,
+		ReputationTTL:     30 * 24 * 3600,
 
-	return nil
+		TorPath:            filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor", "tor"),
+		TorDataDir:         filepath.Join("..", "..", "internal", "tor", "tor-bundle-default", "tor_data"),
+		DatabaseDir:        filepath.Join(baseDir, "database"),
+		PrivateKeyDir:      filepath.Join(baseDir, "keys", "private_key.age"),
+		PlainPrivateKeyDir: filepath.Join(baseDir, "keys", "private_key.pem"),
+		PublicKeyDir:       filepath.Join(baseDir, "keys", "public_key.pem"),
+		OperatorTokenFile:  filepath.Join(baseDir, "operator_token"),
+		TransportBackend:   "tor",
+		AdvertiseHost:      "127.0.0.1",
+	}
 }
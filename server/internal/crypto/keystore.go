@@ -0,0 +1,189 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/FraMan97/kairos/server/internal/config"
+)
+
+const PassphraseEnv = "KAIROS_PASSPHRASE"
+
+var (
+	ErrNoPassphrase    = errors.New("no keystore passphrase, set it with " + PassphraseEnv + ", --passphrase-file or --passphrase-fd")
+	ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+)
+
+// KeyStore holds the key pair of a node. It is unlocked once: the passphrase and the
+// parsed key stay in memory and SignMessage never goes back to the disk.
+type KeyStore struct {
+	privateKeyDir      string
+	plainPrivateKeyDir string
+	publicKeyDir       string
+
+	mu         sync.RWMutex
+	signingKey ed25519.PrivateKey
+	passphrase string
+	publicKey  []byte
+	privateKey []byte
+}
+
+func NewKeyStore(cfg *config.Config) *KeyStore {
+	return &KeyStore{
+		privateKeyDir:      cfg.PrivateKeyDir,
+		plainPrivateKeyDir: cfg.PlainPrivateKeyDir,
+		publicKeyDir:       cfg.PublicKeyDir,
+	}
+}
+
+// ReadPassphrase takes the keystore passphrase from the file descriptor fd, the file at
+// path or the KAIROS_PASSPHRASE environment variable, in this order.
+func ReadPassphrase(path string, fd int) (string, error) {
+	var data []byte
+	var err error
+	switch {
+	case fd >= 0:
+		file := os.NewFile(uintptr(fd), "passphrase")
+		if file == nil {
+			return "", fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		defer file.Close()
+		data, err = io.ReadAll(io.LimitReader(file, 4096))
+	case path != "":
+		data, err = os.ReadFile(path)
+	default:
+		data = []byte(os.Getenv(PassphraseEnv))
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading the passphrase: %w", err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", ErrNoPassphrase
+	}
+	return value, nil
+}
+
+func (k *KeyStore) SetPassphrase(value string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.passphrase = value
+}
+
+func (k *KeyStore) setKeyPair(privateKey ed25519.PrivateKey, privateKeyPEM []byte, publicKeyPEM []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.signingKey = privateKey
+	k.privateKey = privateKeyPEM
+	k.publicKey = publicKeyPEM
+}
+
+// PublicKey returns the PEM public key of the node, nil before the keystore is unlocked.
+func (k *KeyStore) PublicKey() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.publicKey
+}
+
+func (k *KeyStore) PrivateKey() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.privateKey
+}
+
+// SealPrivateKey writes the PEM private key to path encrypted with age (scrypt) under the
+// keystore passphrase.
+func (k *KeyStore) SealPrivateKey(privateKeyPEM []byte, path string) error {
+	k.mu.RLock()
+	value := k.passphrase
+	k.mu.RUnlock()
+	if value == "" {
+		return ErrNoPassphrase
+	}
+	recipient, err := age.NewScryptRecipient(value)
+	if err != nil {
+		return err
+	}
+	var sealed bytes.Buffer
+	writer, err := age.Encrypt(&sealed, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(privateKeyPEM); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	// a crash while writing must not leave a truncated keystore
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, sealed.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("error saving private key: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (k *KeyStore) open() ([]byte, error) {
+	sealed, err := os.ReadFile(k.privateKeyDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return k.migratePlainKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key: %w", err)
+	}
+	k.mu.RLock()
+	value := k.passphrase
+	k.mu.RUnlock()
+	if value == "" {
+		return nil, ErrNoPassphrase
+	}
+	identity, err := age.NewScryptIdentity(value)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := age.Decrypt(bytes.NewReader(sealed), identity)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongPassphrase, err)
+	}
+	return io.ReadAll(reader)
+}
+
+// migratePlainKey moves the plaintext key written by the previous versions into the
+// encrypted keystore.
+func (k *KeyStore) migratePlainKey() ([]byte, error) {
+	privateKeyPEM, err := os.ReadFile(k.plainPrivateKeyDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParsePrivateKey(privateKeyPEM); err != nil {
+		return nil, err
+	}
+	err = k.SealPrivateKey(privateKeyPEM, k.privateKeyDir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Remove(k.plainPrivateKeyDir)
+	if err != nil {
+		return nil, fmt.Errorf("error removing the plaintext private key: %w", err)
+	}
+	log.Println("[Keys] - Plaintext private key moved to the encrypted keystore")
+	return privateKeyPEM, nil
+}
+
+func (k *KeyStore) SignMessage(message []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.signingKey == nil {
+		return nil, fmt.Errorf("the key pair is not loaded")
+	}
+	return ed25519.Sign(k.signingKey, message), nil
+}
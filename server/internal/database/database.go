@@ -10,13 +10,8 @@ import (
 	"github.com/boltdb/bolt"
 )
 
-func OpenDatabase() (*bolt.DB, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-	dbDir := filepath.Join(home, ".kairos", "server", "database")
-	err = os.MkdirAll(dbDir, 0700)
+func OpenDatabase(dbDir string) (*bolt.DB, error) {
+	err := os.MkdirAll(dbDir, 0700)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +20,6 @@ func OpenDatabase() (*bolt.DB, error) {
 		return nil, err
 	}
 	log.Printf("[%s] - BoltDB opened in '%s'\n", config.DatabaseService, dbDir)
-	config.BoltDB = db
 	return db, err
 }
 
@@ -1,9 +1,12 @@
 package models
 
+import "encoding/json"
+
 type SubscriptionRequest struct {
 	Address   string `json:"address"`
 	PublicKey []byte `json:"public_key"`
 	Signature []byte `json:"signature"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 type SynchronizationRequest struct {
@@ -11,6 +14,8 @@ type SynchronizationRequest struct {
 	PublicKey     []byte            `json:"public_key"`
 	ActiveNodes   map[string][]byte `json:"active_nodes"`
 	FileManifests map[string][]byte `json:"chunks"`
+	Tombstones    map[string][]byte `json:"tombstones"`
+	KeyRotations  map[string][]byte `json:"key_rotations"`
 	Signature     []byte            `json:"signature"`
 }
 
@@ -41,13 +46,40 @@ type GetFileManifestRequest struct {
 	FileId    string `json:"file_id"`
 }
 
+type RevokeFileManifestRequest struct {
+	Address   string `json:"address"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+	FileId    string `json:"file_id"`
+}
+
+type ManifestEnvelope struct {
+	Manifest   json.RawMessage `json:"manifest"`
+	PublicKey  []byte          `json:"public_key"`
+	Signature  []byte          `json:"signature"`
+	InsertedAt int64           `json:"inserted_at"`
+	// the rotations from the key the FileId is bound to up to PublicKey
+	Rotations []KeyRotationRequest `json:"rotations,omitempty"`
+}
+
+type ManifestTombstone struct {
+	Request     RevokeFileManifestRequest `json:"request"`
+	ReleaseDate string                    `json:"release_date"`
+	DeletedAt   int64                     `json:"deleted_at"`
+	// the revoked manifest, so a server that never had it can check the owner
+	Envelope ManifestEnvelope `json:"envelope"`
+}
+
 type FileManifest struct {
-	FileName          string            `json:"file_name"`
-	FileId            string            `json:"file_id"`
-	FileSize          int64             `json:"file_size"`
-	ReleaseDate       string            `json:"release_date"`
-	HashFile          string            `json:"hash_file"`
-	HashAlgorithm     string            `json:"hash_algorithm"`
+	FileName      string `json:"file_name"`
+	FileId        string `json:"file_id"`
+	Version       int64  `json:"version"`
+	FileSize      int64  `json:"file_size"`
+	ReleaseDate   string `json:"release_date"`
+	HashFile      string `json:"hash_file"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	// chain hash of the beacon the block keys are time-locked to
+	TimeLockChain     string            `json:"time_lock_chain"`
 	Blocks            int               `json:"blocks"`
 	ChunksPerBlocks   int               `json:"chunks_per_blocks"`
 	ReedSolomonConfig ReedSolomonConfig `json:"reed_solomon_config"`
@@ -65,9 +97,48 @@ type FileBlock struct {
 }
 
 type Chunk struct {
-	ChunkId      string   `json:"chunk_id"`
-	KeyIndexPart byte     `json:"key_index_part"`
-	KeyPart      []byte   `json:"key_part"`
-	ShardIndex   int      `json:"shard_index"`
-	Nodes        []string `json:"nodes"`
+	ChunkId    string   `json:"chunk_id"`
+	ShardIndex int      `json:"shard_index"`
+	Nodes      []string `json:"nodes"`
+}
+
+type NodeReport struct {
+	Node      string `json:"node"`
+	Operation string `json:"operation"`
+	Success   bool   `json:"success"`
+}
+
+type NodeReportRequest struct {
+	Address   string       `json:"address"`
+	PublicKey []byte       `json:"public_key"`
+	Signature []byte       `json:"signature"`
+	Reports   []NodeReport `json:"reports"`
+}
+
+type NodeReputationRecord struct {
+	PublicKey []byte  `json:"public_key"`
+	FirstSeen int64   `json:"first_seen"`
+	LastSeen  int64   `json:"last_seen"`
+	Refreshes int     `json:"refreshes"`
+	Uptime    int64   `json:"uptime"`
+	Successes float64 `json:"successes"`
+	Failures  float64 `json:"failures"`
+	Score     float64 `json:"score"`
+	// Reports holds what each reporter contributed to Successes and Failures
+	Reports map[string]ReporterTally `json:"reports,omitempty"`
+}
+
+type ReporterTally struct {
+	Successes  float64 `json:"successes"`
+	Failures   float64 `json:"failures"`
+	LastReport int64   `json:"last_report"`
+}
+
+type KeyRotationRequest struct {
+	Address      string `json:"address"`
+	OldPublicKey []byte `json:"old_public_key"`
+	NewPublicKey []byte `json:"new_public_key"`
+	RotatedAt    int64  `json:"rotated_at"`
+	OldSignature []byte `json:"old_signature"`
+	NewSignature []byte `json:"new_signature"`
 }
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/FraMan97/kairos/server/internal/database"
+	"github.com/FraMan97/kairos/server/internal/models"
+)
+
+func (s *Server) ExpireNodes(ctx context.Context) {
+	ticker := time.NewTicker(getDelay(s.Config.CronExpire))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.expireNodes()
+
+		case <-ctx.Done():
+			log.Println("[Expire] - Context cancelled, stopping ticker")
+			return
+		}
+	}
+}
+
+func (s *Server) expireNodes() {
+	activeNodes, err := database.GetAllData(s.DB, "active_nodes")
+	if err != nil {
+		log.Println("[Expire] - Error: ", err)
+		return
+	}
+	now := time.Now()
+	for address, data := range activeNodes {
+		var record models.ActiveNodeRecord
+		if json.Unmarshal(data, &record) == nil && s.isAlive(record, now) {
+			continue
+		}
+		err = database.DeleteKey(s.DB, "active_nodes", address)
+		if err != nil {
+			log.Println("[Expire] - Error: ", err)
+			continue
+		}
+		log.Printf("[Expire] - Node %s expired, no heartbeat in the last %ds\n", address, s.Config.NodeTTL)
+	}
+}
+
+// isAlive reports whether the last heartbeat of the record is within the TTL. A record
+// dated in the future is never alive: its age would stay negative forever.
+func (s *Server) isAlive(record models.ActiveNodeRecord, now time.Time) bool {
+	age := now.Sub(time.Unix(0, record.Timestamp))
+	return age >= 0 && age <= time.Duration(s.Config.NodeTTL)*time.Second
+}
+
+// WithinClockSkew reports whether a timestamp set by another host is at most MaxClockSkew
+// away from now.
+func (s *Server) WithinClockSkew(timestamp int64, now time.Time) bool {
+	skew := now.Sub(time.Unix(0, timestamp))
+	maxSkew := time.Duration(s.Config.MaxClockSkew) * time.Second
+	return skew <= maxSkew && skew >= -maxSkew
+}
+
+// GetAliveNodes returns the nodes whose last heartbeat is within the TTL, including the
+// ones not yet removed by the expiry job.
+func (s *Server) GetAliveNodes() ([]string, error) {
+	activeNodes, err := database.GetAllData(s.DB, "active_nodes")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	alive := make([]string, 0, len(activeNodes))
+	for address, data := range activeNodes {
+		var record models.ActiveNodeRecord
+		if json.Unmarshal(data, &record) == nil && s.isAlive(record, now) {
+			alive = append(alive, address)
+		}
+	}
+	return alive, nil
+}
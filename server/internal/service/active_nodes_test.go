@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FraMan97/kairos/server/internal/config"
+	"github.com/FraMan97/kairos/server/internal/models"
+)
+
+func TestIsAlive(t *testing.T) {
+	s := &Server{Config: config.New(t.TempDir())}
+	now := time.Now()
+	ttl := time.Duration(s.Config.NodeTTL) * time.Second
+
+	tests := []struct {
+		name      string
+		heartbeat time.Time
+		alive     bool
+	}{
+		{"recent heartbeat", now.Add(-time.Minute), true},
+		{"heartbeat older than the TTL", now.Add(-ttl - time.Second), false},
+		{"heartbeat dated in the future", now.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.isAlive(models.ActiveNodeRecord{Timestamp: tt.heartbeat.UnixNano()}, now); got != tt.alive {
+				t.Fatalf("isAlive = %v, want %v", got, tt.alive)
+			}
+		})
+	}
+}
+
+func TestWithinClockSkew(t *testing.T) {
+	s := &Server{Config: config.New(t.TempDir())}
+	now := time.Now()
+	maxSkew := time.Duration(s.Config.MaxClockSkew) * time.Second
+
+	if !s.WithinClockSkew(now.Add(-maxSkew/2).UnixNano(), now) || !s.WithinClockSkew(now.Add(maxSkew/2).UnixNano(), now) {
+		t.Fatal("timestamp within the skew refused")
+	}
+	if s.WithinClockSkew(now.Add(-maxSkew-time.Second).UnixNano(), now) {
+		t.Fatal("stale timestamp accepted")
+	}
+	if s.WithinClockSkew(now.Add(maxSkew+time.Second).UnixNano(), now) {
+		t.Fatal("future timestamp accepted")
+	}
+}
@@ -5,22 +5,20 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-	"slices"
 	"time"
 
-	"github.com/FraMan97/kairos/server/internal/config"
 	"github.com/FraMan97/kairos/server/internal/database"
 	"github.com/FraMan97/kairos/server/internal/models"
 )
 
-func CleanOldRecords(ctx context.Context) {
-	ticker := time.NewTicker(getDelay(config.CronClean))
+func (s *Server) CleanOldRecords(ctx context.Context) {
+	ticker := time.NewTicker(getDelay(s.Config.CronClean))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			clean()
+			s.clean()
 
 		case <-ctx.Done():
 			log.Println("[Sync] - Context cancelled, stopping ticker")
@@ -29,17 +27,19 @@ func CleanOldRecords(ctx context.Context) {
 	}
 }
 
-func clean() {
-	allManifestsData, err := database.GetAllData(config.BoltDB, "manifests")
+func (s *Server) clean() {
+	allManifestsData, err := database.GetAllData(s.DB, "manifests")
 	if err != nil {
 		log.Println("[Clean] - Error: ", err)
 		return
 	}
 	var manifest models.FileManifest
+	var envelope models.ManifestEnvelope
 	var parsedTime time.Time
 	var now time.Time
 	for _, m := range allManifestsData {
-		json.NewDecoder(bytes.NewBuffer(m)).Decode(&manifest)
+		json.NewDecoder(bytes.NewBuffer(m)).Decode(&envelope)
+		json.Unmarshal(envelope.Manifest, &manifest)
 		parsedTime, err = time.Parse(time.RFC3339, manifest.ReleaseDate)
 		if err != nil {
 			log.Println("[Clean] - Error: ", err)
@@ -48,41 +48,33 @@ func clean() {
 		oneWeekLater := parsedTime.Add(time.Hour * 24 * 7) // clean old manifests after 1 week
 		now = time.Now().UTC()
 		if now.After(oneWeekLater) {
-			err = database.DeleteKey(config.BoltDB, "manifests", manifest.FileId)
+			err = database.DeleteKey(s.DB, "manifests", manifest.FileId)
 			if err != nil {
 				log.Println("[Clean] - Error: ", err)
 			}
 		}
 	}
 
-	allManifestsData, err = database.GetAllData(config.BoltDB, "manifests")
+	allTombstonesData, err := database.GetAllData(s.DB, "tombstones")
 	if err != nil {
 		log.Println("[Clean] - Error: ", err)
 		return
 	}
-
-	allActiveNodes, err := database.GetAllKeys(config.BoltDB, "active_nodes")
-	if err != nil {
-		log.Println("[Clean] - Error: ", err)
-		return
-	}
-	for _, a := range allActiveNodes {
-		found := false
-		for _, m := range allManifestsData {
-			json.NewDecoder(bytes.NewBuffer(m)).Decode(&manifest)
-			for _, b := range manifest.Split {
-				for _, c := range b.Chunks {
-					if slices.Contains(c.Nodes, a) {
-						found = true
-					}
-				}
-			}
+	var tombstone models.ManifestTombstone
+	for k, t := range allTombstonesData {
+		json.NewDecoder(bytes.NewBuffer(t)).Decode(&tombstone)
+		expiry := time.Unix(0, tombstone.DeletedAt)
+		parsedTime, err = time.Parse(time.RFC3339, tombstone.ReleaseDate)
+		if err == nil && parsedTime.After(expiry) {
+			expiry = parsedTime
 		}
-		if found {
-			err = database.DeleteKey(config.BoltDB, "active_nodes", a)
+		if time.Now().UTC().After(expiry.Add(time.Hour * 24 * 7)) { // keep tombstones as long as a peer could still hold the manifest
+			err = database.DeleteKey(s.DB, "tombstones", k)
 			if err != nil {
 				log.Println("[Clean] - Error: ", err)
 			}
 		}
 	}
+
+	s.cleanReputations()
 }
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/FraMan97/kairos/server/internal/crypto"
+	"github.com/FraMan97/kairos/server/internal/database"
+	"github.com/FraMan97/kairos/server/internal/models"
+	"github.com/boltdb/bolt"
+)
+
+// a rotation chain longer than this is treated as broken
+const maxRotationChain = 64
+
+// VerifyKeyRotation checks that the announcement is signed by both keys: the old one
+// hands over its identity, the new one proves it is held by the same node.
+func VerifyKeyRotation(request models.KeyRotationRequest) error {
+	if crypto.SamePublicKey(request.OldPublicKey, request.NewPublicKey) {
+		return fmt.Errorf("the new key is the same as the old one")
+	}
+	message, err := json.Marshal(models.KeyRotationRequest{Address: request.Address, OldPublicKey: request.OldPublicKey,
+		NewPublicKey: request.NewPublicKey, RotatedAt: request.RotatedAt})
+	if err != nil {
+		return err
+	}
+	check, err := crypto.VerifySignature(message, request.OldSignature, request.OldPublicKey)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("rotation not signed by the old key")
+	}
+	check, err = crypto.VerifySignature(message, request.NewSignature, request.NewPublicKey)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("rotation not signed by the new key")
+	}
+	return nil
+}
+
+// ApplyKeyRotation records the rotation and moves the node record and its reputation to
+// the new key. A key can be rotated only once and only to a key that was never rotated.
+func (s *Server) ApplyKeyRotation(request models.KeyRotationRequest) error {
+	err := VerifyKeyRotation(request)
+	if err != nil {
+		return err
+	}
+	oldFingerprint := crypto.Fingerprint(request.OldPublicKey)
+	if current, err := s.getKeyRotation(oldFingerprint); err == nil {
+		if crypto.SamePublicKey(current.NewPublicKey, request.NewPublicKey) {
+			return nil
+		}
+		return fmt.Errorf("key %s was already rotated to another key", oldFingerprint)
+	}
+	if !crypto.SamePublicKey(s.CurrentKey(request.NewPublicKey), request.NewPublicKey) {
+		return fmt.Errorf("the new key was already rotated away")
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	err = database.PutData(s.DB, "key_rotations", oldFingerprint, payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := database.GetData(s.DB, "active_nodes", request.Address)
+	if err == nil {
+		var record models.ActiveNodeRecord
+		if json.Unmarshal(data, &record) == nil && crypto.SamePublicKey(record.PublicKey, request.OldPublicKey) {
+			record.PublicKey = request.NewPublicKey
+			if payload, err := json.Marshal(record); err == nil {
+				database.PutData(s.DB, "active_nodes", request.Address, payload)
+			}
+		}
+	}
+	reputation, err := s.getReputationRecord(request.Address)
+	if err == nil && crypto.SamePublicKey(reputation.PublicKey, request.OldPublicKey) {
+		reputation.PublicKey = request.NewPublicKey
+		return s.putReputationRecord(request.Address, reputation)
+	}
+	return nil
+}
+
+func (s *Server) applyKeyRotationData(data []byte) error {
+	var request models.KeyRotationRequest
+	err := json.Unmarshal(data, &request)
+	if err != nil {
+		return err
+	}
+	return s.ApplyKeyRotation(request)
+}
+
+func (s *Server) getKeyRotation(fingerprint string) (request *models.KeyRotationRequest, err error) {
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		request, err = getKeyRotation(tx, fingerprint)
+		return err
+	})
+	return request, err
+}
+
+func getKeyRotation(tx *bolt.Tx, fingerprint string) (*models.KeyRotationRequest, error) {
+	data := tx.Bucket([]byte("key_rotations")).Get([]byte(fingerprint))
+	if data == nil {
+		return nil, fmt.Errorf("key %s was not rotated", fingerprint)
+	}
+	var request models.KeyRotationRequest
+	err := json.Unmarshal(data, &request)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// CurrentKey follows the announced rotations from publicKey to the key in use today.
+func (s *Server) CurrentKey(publicKey []byte) (current []byte) {
+	s.DB.View(func(tx *bolt.Tx) error {
+		current = currentKey(tx, publicKey)
+		return nil
+	})
+	return current
+}
+
+func currentKey(tx *bolt.Tx, publicKey []byte) []byte {
+	current := publicKey
+	for i := 0; i < maxRotationChain; i++ {
+		rotation, err := getKeyRotation(tx, crypto.Fingerprint(current))
+		if err != nil {
+			return current
+		}
+		current = rotation.NewPublicKey
+	}
+	return current
+}
+
+// RotationChain returns the rotations that lead from one key to another, nil when they are
+// the same key.
+func (s *Server) RotationChain(from []byte, to []byte) (chain []models.KeyRotationRequest, err error) {
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		chain, err = rotationChain(tx, from, to)
+		return err
+	})
+	return chain, err
+}
+
+func rotationChain(tx *bolt.Tx, from []byte, to []byte) ([]models.KeyRotationRequest, error) {
+	chain := []models.KeyRotationRequest{}
+	current := from
+	for i := 0; i < maxRotationChain; i++ {
+		if crypto.SamePublicKey(current, to) {
+			return chain, nil
+		}
+		rotation, err := getKeyRotation(tx, crypto.Fingerprint(current))
+		if err != nil {
+			return nil, fmt.Errorf("key %s was not rotated to %s", crypto.Fingerprint(from), crypto.Fingerprint(to))
+		}
+		chain = append(chain, *rotation)
+		current = rotation.NewPublicKey
+	}
+	return nil, fmt.Errorf("rotation chain of key %s too long", crypto.Fingerprint(from))
+}
+
+// IsOwnerKey tells if sender may act on what owner published: the owner itself, or the
+// key it was rotated to. A key that has been rotated away loses its rights.
+func (s *Server) IsOwnerKey(owner []byte, sender []byte) bool {
+	return crypto.SamePublicKey(s.CurrentKey(owner), sender)
+}
+
+func isOwnerKey(tx *bolt.Tx, owner []byte, sender []byte) bool {
+	return crypto.SamePublicKey(currentKey(tx, owner), sender)
+}
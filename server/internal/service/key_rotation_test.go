@@ -0,0 +1,70 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/FraMan97/kairos/server/internal/crypto"
+	"github.com/FraMan97/kairos/server/internal/models"
+)
+
+func newTestKey(t *testing.T) (ed25519.PrivateKey, []byte) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, err := crypto.EncodePublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, publicKeyPEM
+}
+
+func signedRotation(t *testing.T, oldKey ed25519.PrivateKey, oldPublicKey []byte, newKey ed25519.PrivateKey, newPublicKey []byte) models.KeyRotationRequest {
+	t.Helper()
+	rotation := models.KeyRotationRequest{Address: "node.onion:8081", OldPublicKey: oldPublicKey, NewPublicKey: newPublicKey, RotatedAt: 42}
+	message, err := json.Marshal(rotation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotation.OldSignature = ed25519.Sign(oldKey, message)
+	rotation.NewSignature = ed25519.Sign(newKey, message)
+	return rotation
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	oldKey, oldPublicKey := newTestKey(t)
+	newKey, newPublicKey := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+
+	if err := VerifyKeyRotation(signedRotation(t, oldKey, oldPublicKey, newKey, newPublicKey)); err != nil {
+		t.Fatalf("valid rotation refused: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		rotation models.KeyRotationRequest
+	}{
+		{"same key", signedRotation(t, oldKey, oldPublicKey, oldKey, oldPublicKey)},
+		{"old signature from another key", signedRotation(t, otherKey, oldPublicKey, newKey, newPublicKey)},
+		{"new signature from another key", signedRotation(t, oldKey, oldPublicKey, otherKey, newPublicKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyKeyRotation(tt.rotation); err == nil {
+				t.Fatal("rotation accepted")
+			}
+		})
+	}
+
+	t.Run("tampered timestamp", func(t *testing.T) {
+		rotation := signedRotation(t, oldKey, oldPublicKey, newKey, newPublicKey)
+		rotation.RotatedAt++
+		if err := VerifyKeyRotation(rotation); err == nil {
+			t.Fatal("rotation accepted")
+		}
+	})
+}
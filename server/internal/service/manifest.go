@@ -0,0 +1,262 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FraMan97/kairos/server/internal/crypto"
+	"github.com/FraMan97/kairos/server/internal/database"
+	"github.com/FraMan97/kairos/server/internal/models"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	ErrManifestRevoked     = errors.New("manifest revoked")
+	ErrNotBoundToPublisher = errors.New("FileId not bound to the key of the sender")
+	ErrNotManifestOwner    = errors.New("manifest already published by another node")
+	ErrManifestOutdated    = errors.New("manifest older than the published one")
+)
+
+func (s *Server) GetManifestEnvelope(fileId string) (*models.ManifestEnvelope, error) {
+	data, err := database.GetData(s.DB, "manifests", fileId)
+	if err != nil {
+		return nil, err
+	}
+	var envelope models.ManifestEnvelope
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+func getManifestEnvelope(tx *bolt.Tx, fileId string) (*models.ManifestEnvelope, error) {
+	data := tx.Bucket([]byte("manifests")).Get([]byte(fileId))
+	if data == nil {
+		return nil, nil
+	}
+	var envelope models.ManifestEnvelope
+	err := json.Unmarshal(data, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+// InsertFileManifest stores a manifest published by publicKey. The tombstone, the owner
+// and the version are checked in the transaction that writes it, so neither a concurrent
+// publish nor a revoke can slip in between.
+func (s *Server) InsertFileManifest(manifest models.FileManifest, manifestBytes []byte, publicKey []byte, signature []byte) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("tombstones")).Get([]byte(manifest.FileId)) != nil {
+			return ErrManifestRevoked
+		}
+		var rotations []models.KeyRotationRequest
+		current, err := getManifestEnvelope(tx, manifest.FileId)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			if !IsBoundToPublisher(manifest.FileId, publicKey) {
+				return ErrNotBoundToPublisher
+			}
+		} else {
+			if !isOwnerKey(tx, current.PublicKey, publicKey) {
+				return ErrNotManifestOwner
+			}
+			currentVersion, err := ManifestVersion(*current)
+			if err != nil || manifest.Version <= currentVersion {
+				return ErrManifestOutdated
+			}
+			// downloaders follow the rotations from the key the FileId is bound to
+			chain, err := rotationChain(tx, current.PublicKey, publicKey)
+			if err != nil {
+				return err
+			}
+			rotations = append(current.Rotations, chain...)
+		}
+		envelope, err := json.Marshal(models.ManifestEnvelope{Manifest: manifestBytes, PublicKey: publicKey,
+			Signature: signature, InsertedAt: time.Now().UnixNano(), Rotations: rotations})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("manifests")).Put([]byte(manifest.FileId), envelope)
+	})
+}
+
+// storeSyncedManifest keeps a manifest received from a peer if it is not revoked and is
+// newer than the one stored, both checked in the transaction that writes it.
+func (s *Server) storeSyncedManifest(fileId string, received models.ManifestEnvelope, version int64, data []byte) error {
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("tombstones")).Get([]byte(fileId)) != nil {
+			return nil
+		}
+		current, err := getManifestEnvelope(tx, fileId)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			// the version is signed by the publisher: a peer can't roll the manifest back
+			currentVersion, err := ManifestVersion(*current)
+			if err != nil || !isOwnerKey(tx, current.PublicKey, received.PublicKey) || currentVersion >= version {
+				return nil
+			}
+		}
+		return tx.Bucket([]byte("manifests")).Put([]byte(fileId), data)
+	})
+}
+
+func VerifyManifestEnvelope(envelope models.ManifestEnvelope) (bool, error) {
+	hashToVerify := sha256.Sum256(envelope.Manifest)
+	return crypto.VerifySignature(hashToVerify[:], envelope.Signature, envelope.PublicKey)
+}
+
+// IsBoundToPublisher tells if the FileId carries the tag of publicKey: only that key, or
+// the keys it was rotated to, can publish the manifest.
+func IsBoundToPublisher(fileId string, publicKey []byte) bool {
+	i := strings.LastIndex(fileId, ".")
+	return i >= 0 && fileId[i+1:] == crypto.PublisherTag(publicKey)
+}
+
+// VerifyManifestPublisher checks that the envelope is signed by the key its FileId is
+// bound to or by a key it was rotated to, through the rotations the envelope carries.
+func VerifyManifestPublisher(fileId string, envelope models.ManifestEnvelope) error {
+	publisher := envelope.PublicKey
+	if len(envelope.Rotations) > 0 {
+		publisher = envelope.Rotations[0].OldPublicKey
+	}
+	if !IsBoundToPublisher(fileId, publisher) {
+		return fmt.Errorf("manifest %s not published by the key its FileId is bound to", fileId)
+	}
+	current := publisher
+	for _, rotation := range envelope.Rotations {
+		if !crypto.SamePublicKey(rotation.OldPublicKey, current) {
+			return fmt.Errorf("broken rotation chain for manifest %s", fileId)
+		}
+		err := VerifyKeyRotation(rotation)
+		if err != nil {
+			return err
+		}
+		current = rotation.NewPublicKey
+	}
+	if !crypto.SamePublicKey(current, envelope.PublicKey) {
+		return fmt.Errorf("the rotations of manifest %s don't lead to its signer", fileId)
+	}
+	return nil
+}
+
+// ManifestVersion returns the version the publisher signed in the manifest: the newest
+// wins, whatever the order the servers received them in.
+func ManifestVersion(envelope models.ManifestEnvelope) (int64, error) {
+	var manifest models.FileManifest
+	err := json.Unmarshal(envelope.Manifest, &manifest)
+	if err != nil {
+		return 0, err
+	}
+	return manifest.Version, nil
+}
+
+func (s *Server) GetTombstone(fileId string) (*models.ManifestTombstone, error) {
+	data, err := database.GetData(s.DB, "tombstones", fileId)
+	if err != nil {
+		return nil, err
+	}
+	var tombstone models.ManifestTombstone
+	err = json.Unmarshal(data, &tombstone)
+	if err != nil {
+		return nil, err
+	}
+	return &tombstone, nil
+}
+
+// IsRevoked tells if the FileId was revoked: it can't be published again, whatever the key.
+func (s *Server) IsRevoked(fileId string) bool {
+	exists, _ := database.ExistsKey(s.DB, "tombstones", fileId)
+	return exists
+}
+
+func VerifyRevokeRequest(request models.RevokeFileManifestRequest) (bool, error) {
+	message, err := json.Marshal(models.RevokeFileManifestRequest{Address: request.Address, PublicKey: request.PublicKey, FileId: request.FileId})
+	if err != nil {
+		return false, err
+	}
+	return crypto.VerifySignature(message, request.Signature, request.PublicKey)
+}
+
+func (s *Server) RevokeFileManifest(request models.RevokeFileManifestRequest) error {
+	envelope, err := s.GetManifestEnvelope(request.FileId)
+	if err != nil {
+		return err
+	}
+	if !s.IsOwnerKey(envelope.PublicKey, request.PublicKey) {
+		return fmt.Errorf("manifest %s was not published by the sender", request.FileId)
+	}
+	var manifest models.FileManifest
+	err = json.Unmarshal(envelope.Manifest, &manifest)
+	if err != nil {
+		return err
+	}
+	tombstone := models.ManifestTombstone{Request: request, ReleaseDate: manifest.ReleaseDate, DeletedAt: time.Now().UnixNano(), Envelope: *envelope}
+	return s.storeTombstone(tombstone)
+}
+
+func (s *Server) applyTombstone(data []byte) error {
+	var tombstone models.ManifestTombstone
+	err := json.Unmarshal(data, &tombstone)
+	if err != nil {
+		return err
+	}
+	check, err := VerifyRevokeRequest(tombstone.Request)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("tombstone for manifest %s not verified", tombstone.Request.FileId)
+	}
+	err = verifyRevokedEnvelope(tombstone.Request.FileId, tombstone.Envelope)
+	if err != nil {
+		return err
+	}
+	if !s.IsOwnerKey(tombstone.Envelope.PublicKey, tombstone.Request.PublicKey) {
+		return fmt.Errorf("tombstone for manifest %s not signed by its publisher", tombstone.Request.FileId)
+	}
+	return s.storeTombstone(tombstone)
+}
+
+func verifyRevokedEnvelope(fileId string, envelope models.ManifestEnvelope) error {
+	check, err := VerifyManifestEnvelope(envelope)
+	if err != nil {
+		return err
+	}
+	if !check {
+		return fmt.Errorf("revoked manifest %s not verified", fileId)
+	}
+	var manifest models.FileManifest
+	err = json.Unmarshal(envelope.Manifest, &manifest)
+	if err != nil {
+		return err
+	}
+	if manifest.FileId != fileId {
+		return fmt.Errorf("tombstone for manifest %s carries the manifest %s", fileId, manifest.FileId)
+	}
+	return VerifyManifestPublisher(fileId, envelope)
+}
+
+func (s *Server) storeTombstone(tombstone models.ManifestTombstone) error {
+	payload, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+	fileId := []byte(tombstone.Request.FileId)
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte("tombstones")).Put(fileId, payload)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("manifests")).Delete(fileId)
+	})
+}
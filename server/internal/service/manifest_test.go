@@ -0,0 +1,156 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/FraMan97/kairos/server/internal/config"
+	"github.com/FraMan97/kairos/server/internal/crypto"
+	"github.com/FraMan97/kairos/server/internal/models"
+)
+
+func signedEnvelope(t *testing.T, privateKey ed25519.PrivateKey, publicKey []byte, manifest models.FileManifest) models.ManifestEnvelope {
+	t.Helper()
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(raw)
+	return models.ManifestEnvelope{Manifest: raw, PublicKey: publicKey, Signature: ed25519.Sign(privateKey, hash[:])}
+}
+
+func TestVerifyManifestEnvelope(t *testing.T) {
+	privateKey, publicKey := newTestKey(t)
+	otherKey, otherPublicKey := newTestKey(t)
+	manifest := models.FileManifest{FileId: "file-1", FileName: "report.pdf", ReleaseDate: "2030-01-01T00:00:00Z"}
+
+	check, err := VerifyManifestEnvelope(signedEnvelope(t, privateKey, publicKey, manifest))
+	if err != nil || !check {
+		t.Fatalf("valid envelope refused: %v", err)
+	}
+
+	tampered := signedEnvelope(t, privateKey, publicKey, manifest)
+	tampered.Manifest = []byte(`{"file_id":"file-1","file_name":"other.pdf"}`)
+	if check, _ := VerifyManifestEnvelope(tampered); check {
+		t.Fatal("tampered manifest accepted")
+	}
+
+	wrongKey := signedEnvelope(t, otherKey, publicKey, manifest)
+	if check, _ := VerifyManifestEnvelope(wrongKey); check {
+		t.Fatal("envelope signed by another key accepted")
+	}
+
+	swapped := signedEnvelope(t, privateKey, otherPublicKey, manifest)
+	if check, _ := VerifyManifestEnvelope(swapped); check {
+		t.Fatal("envelope with a swapped public key accepted")
+	}
+
+	if _, err := VerifyManifestEnvelope(models.ManifestEnvelope{Manifest: []byte("{}"), PublicKey: []byte("not a key")}); err == nil {
+		t.Fatal("invalid public key accepted")
+	}
+}
+
+func TestVerifyRevokedEnvelope(t *testing.T) {
+	privateKey, publicKey := newTestKey(t)
+	otherKey, otherPublicKey := newTestKey(t)
+	fileId := "file-1." + crypto.PublisherTag(publicKey)
+	envelope := signedEnvelope(t, privateKey, publicKey, models.FileManifest{FileId: fileId})
+
+	if err := verifyRevokedEnvelope(fileId, envelope); err != nil {
+		t.Fatalf("valid tombstone envelope refused: %v", err)
+	}
+	if err := verifyRevokedEnvelope("file-2."+crypto.PublisherTag(publicKey), envelope); err == nil {
+		t.Fatal("envelope of another manifest accepted")
+	}
+	forged := signedEnvelope(t, otherKey, otherPublicKey, models.FileManifest{FileId: fileId})
+	if err := verifyRevokedEnvelope(fileId, forged); err == nil {
+		t.Fatal("envelope signed by another key than the publisher accepted")
+	}
+}
+
+func TestVerifyManifestPublisher(t *testing.T) {
+	privateKey, publicKey := newTestKey(t)
+	newKey, newPublicKey := newTestKey(t)
+	otherKey, otherPublicKey := newTestKey(t)
+	fileId := "file-1." + crypto.PublisherTag(publicKey)
+
+	if err := VerifyManifestPublisher(fileId, signedEnvelope(t, privateKey, publicKey, models.FileManifest{FileId: fileId})); err != nil {
+		t.Fatalf("manifest of the bound key refused: %v", err)
+	}
+	if err := VerifyManifestPublisher(fileId, signedEnvelope(t, otherKey, otherPublicKey, models.FileManifest{FileId: fileId})); err == nil {
+		t.Fatal("manifest signed by another key accepted")
+	}
+	if err := VerifyManifestPublisher("file-1", signedEnvelope(t, privateKey, publicKey, models.FileManifest{FileId: "file-1"})); err == nil {
+		t.Fatal("FileId without a publisher tag accepted")
+	}
+
+	rotated := signedEnvelope(t, newKey, newPublicKey, models.FileManifest{FileId: fileId})
+	rotated.Rotations = []models.KeyRotationRequest{signedRotation(t, privateKey, publicKey, newKey, newPublicKey)}
+	if err := VerifyManifestPublisher(fileId, rotated); err != nil {
+		t.Fatalf("manifest of the rotated key refused: %v", err)
+	}
+
+	// a rotation made up by the server is not signed by the bound key
+	forged := signedEnvelope(t, otherKey, otherPublicKey, models.FileManifest{FileId: fileId})
+	forged.Rotations = []models.KeyRotationRequest{signedRotation(t, otherKey, publicKey, otherKey, otherPublicKey)}
+	if err := VerifyManifestPublisher(fileId, forged); err == nil {
+		t.Fatal("forged rotation accepted")
+	}
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := NewServer(config.New(t.TempDir()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestInsertFileManifest(t *testing.T) {
+	s := newTestServer(t)
+	privateKey, publicKey := newTestKey(t)
+	otherKey, otherPublicKey := newTestKey(t)
+	fileId := "file-1." + crypto.PublisherTag(publicKey)
+	insert := func(key ed25519.PrivateKey, publicKey []byte, version int64) error {
+		envelope := signedEnvelope(t, key, publicKey, models.FileManifest{FileId: fileId, Version: version})
+		return s.InsertFileManifest(models.FileManifest{FileId: fileId, Version: version}, envelope.Manifest, publicKey, envelope.Signature)
+	}
+
+	if err := insert(otherKey, otherPublicKey, 1); !errors.Is(err, ErrNotBoundToPublisher) {
+		t.Fatalf("FileId of another key: got %v", err)
+	}
+	// concurrent publishes: whatever the order, the newest version stays
+	var wg sync.WaitGroup
+	for version := int64(1); version <= 16; version++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			insert(privateKey, publicKey, version)
+		}()
+	}
+	wg.Wait()
+	current, err := s.GetManifestEnvelope(fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := ManifestVersion(*current); version != 16 {
+		t.Fatalf("version %d stored after concurrent publishes, want 16", version)
+	}
+	if err := insert(privateKey, publicKey, 16); !errors.Is(err, ErrManifestOutdated) {
+		t.Fatalf("same version published again: got %v", err)
+	}
+
+	err = s.storeTombstone(models.ManifestTombstone{Request: models.RevokeFileManifestRequest{FileId: fileId}, Envelope: *current})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := insert(privateKey, publicKey, 17); !errors.Is(err, ErrManifestRevoked) {
+		t.Fatalf("publish after the revoke: got %v", err)
+	}
+}
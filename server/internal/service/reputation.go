@@ -0,0 +1,206 @@
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/FraMan97/kairos/server/internal/crypto"
+	"github.com/FraMan97/kairos/server/internal/database"
+	"github.com/FraMan97/kairos/server/internal/models"
+)
+
+// RecordSubscription counts a subscription refresh: the time since the previous one
+// is added to the uptime only if the node refreshed within the expected gap.
+func (s *Server) RecordSubscription(address string, publicKey []byte) error {
+	now := time.Now().UnixNano()
+	record, err := s.getReputationRecord(address)
+	if err != nil || !crypto.SamePublicKey(record.PublicKey, publicKey) {
+		// a new key on the same address is a different node
+		record = &models.NodeReputationRecord{PublicKey: publicKey, FirstSeen: now}
+	} else if gap := now - record.LastSeen; gap <= int64(time.Duration(s.Config.MaxRefreshGap)*time.Second) {
+		record.Uptime += gap
+	}
+	record.LastSeen = now
+	record.Refreshes++
+	return s.putReputationRecord(address, record)
+}
+
+// RecordNodeReports applies the results reported by a subscribed node. Reports about
+// the reporter itself or about unknown nodes are ignored, and a reporter counts at most
+// once per ReportWindow for each node. Each report weighs as much as the uptime of the
+// reporter allows, so a swarm of fresh keys can't move the scores.
+func (s *Server) RecordNodeReports(reporter string, publicKey []byte, reports []models.NodeReport) (int, error) {
+	if len(reports) > s.Config.MaxReportsPerReq {
+		reports = reports[:s.Config.MaxReportsPerReq]
+	}
+	weight := s.reporterWeight(reporter, publicKey)
+	if weight == 0 {
+		return 0, nil
+	}
+	now := time.Now().UnixNano()
+	window := int64(time.Duration(s.Config.ReportWindow) * time.Second)
+	applied := 0
+	for _, report := range reports {
+		if report.Node == reporter {
+			continue
+		}
+		record, err := s.getReputationRecord(report.Node)
+		if err != nil {
+			continue
+		}
+		if record.Reports == nil {
+			record.Reports = make(map[string]models.ReporterTally)
+		}
+		tally, ok := record.Reports[reporter]
+		if ok && now-tally.LastReport < window {
+			continue
+		}
+		tally.LastReport = now
+		s.applyReport(record, &tally, report.Success, weight)
+		record.Reports[reporter] = tally
+		err = s.putReputationRecord(report.Node, record)
+		if err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// reporterWeight is the weight of the reports of a node: its uptime over ReporterUptime,
+// at most 1. A node never seen refreshing its subscription under this key weighs nothing.
+func (s *Server) reporterWeight(reporter string, publicKey []byte) float64 {
+	record, err := s.getReputationRecord(reporter)
+	if err != nil || !crypto.SamePublicKey(record.PublicKey, publicKey) {
+		return 0
+	}
+	full := float64(time.Duration(s.Config.ReporterUptime) * time.Second)
+	return math.Min(float64(record.Uptime)/full, 1)
+}
+
+// applyReport adds one report of the given weight to the record. Past MaxReporterWeight
+// the reporter trades older reports of the opposite kind for the new one: it can change
+// its mind, but it never weighs more than MaxReporterWeight full reports.
+func (s *Server) applyReport(record *models.NodeReputationRecord, tally *models.ReporterTally, success bool, weight float64) {
+	same, opposite := &tally.Successes, &tally.Failures
+	recordSame, recordOpposite := &record.Successes, &record.Failures
+	if !success {
+		same, opposite = opposite, same
+		recordSame, recordOpposite = recordOpposite, recordSame
+	}
+	added := math.Max(math.Min(weight, float64(s.Config.MaxReporterWeight)-*same-*opposite), 0)
+	traded := math.Min(weight-added, *opposite)
+	*opposite -= traded
+	*recordOpposite -= traded
+	*same += added + traded
+	*recordSame += added + traded
+}
+
+func (s *Server) IsSubscribedNode(address string, publicKey []byte) bool {
+	data, err := database.GetData(s.DB, "active_nodes", address)
+	if err != nil {
+		return false
+	}
+	var record models.ActiveNodeRecord
+	if json.Unmarshal(data, &record) != nil {
+		return false
+	}
+	return crypto.SamePublicKey(record.PublicKey, publicKey)
+}
+
+func (s *Server) getReputationRecord(address string) (*models.NodeReputationRecord, error) {
+	data, err := database.GetData(s.DB, "reputation", address)
+	if err != nil {
+		return nil, err
+	}
+	var record models.NodeReputationRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *Server) putReputationRecord(address string, record *models.NodeReputationRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return database.PutData(s.DB, "reputation", address, payload)
+}
+
+// reputationScore multiplies the share of successful reports by the share of time the
+// node was seen online. Both are smoothed so that a new node starts in the middle
+// instead of being starved or preferred.
+func (s *Server) reputationScore(record *models.NodeReputationRecord, now int64) float64 {
+	reliability := (record.Successes + 1) / (record.Successes + record.Failures + 2)
+	prior := float64(time.Duration(s.Config.UptimePrior) * time.Second)
+	observed := float64(max(now-record.FirstSeen, 0))
+	uptime := (float64(record.Uptime) + prior/2) / (observed + prior)
+	return reliability * math.Min(uptime, 1)
+}
+
+func (s *Server) GetNodeReputations() (map[string]models.NodeReputationRecord, error) {
+	data, err := database.GetAllData(s.DB, "reputation")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	reputations := make(map[string]models.NodeReputationRecord)
+	for address, v := range data {
+		var record models.NodeReputationRecord
+		err = json.Unmarshal(v, &record)
+		if err != nil {
+			return nil, err
+		}
+		record.Score = s.reputationScore(&record, now)
+		reputations[address] = record
+	}
+	return reputations, nil
+}
+
+// PickReliableNodes draws n nodes without replacement, each one with a probability
+// proportional to its score (Efraimidis-Spirakis weighted sampling).
+func (s *Server) PickReliableNodes(nodes []string, n int) []string {
+	if n > len(nodes) {
+		n = len(nodes)
+	}
+	now := time.Now().UnixNano()
+	type weightedNode struct {
+		address string
+		key     float64
+	}
+	weighted := make([]weightedNode, 0, len(nodes))
+	for _, node := range nodes {
+		weight := s.Config.MinNodeWeight
+		if record, err := s.getReputationRecord(node); err == nil {
+			weight = math.Max(s.reputationScore(record, now), s.Config.MinNodeWeight)
+		}
+		weighted = append(weighted, weightedNode{address: node, key: math.Pow(rand.Float64(), 1/weight)})
+	}
+	sort.Slice(weighted, func(i, j int) bool { return weighted[i].key > weighted[j].key })
+
+	selected := make([]string, 0, n)
+	for _, w := range weighted[:n] {
+		selected = append(selected, w.address)
+	}
+	return selected
+}
+
+func (s *Server) cleanReputations() {
+	data, err := database.GetAllData(s.DB, "reputation")
+	if err != nil {
+		return
+	}
+	expiry := time.Now().Add(-time.Duration(s.Config.ReputationTTL) * time.Second).UnixNano()
+	for address, v := range data {
+		var record models.NodeReputationRecord
+		if json.Unmarshal(v, &record) == nil && record.LastSeen > expiry {
+			continue
+		}
+		database.DeleteKey(s.DB, "reputation", address)
+	}
+}
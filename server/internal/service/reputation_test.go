@@ -0,0 +1,46 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/FraMan97/kairos/server/internal/config"
+	"github.com/FraMan97/kairos/server/internal/models"
+)
+
+func TestApplyReport(t *testing.T) {
+	s := &Server{Config: config.New(t.TempDir())}
+	limit := float64(s.Config.MaxReporterWeight)
+
+	var record models.NodeReputationRecord
+	var tally models.ReporterTally
+	for i := 0; i < 2*s.Config.MaxReporterWeight; i++ {
+		s.applyReport(&record, &tally, false, 1)
+	}
+	if record.Failures != limit {
+		t.Fatalf("a full reporter weighs %v failures, want at most %v", record.Failures, limit)
+	}
+	s.applyReport(&record, &tally, true, 1)
+	if record.Successes != 1 || record.Failures != limit-1 {
+		t.Fatalf("a full reporter changing its mind left %v successes and %v failures", record.Successes, record.Failures)
+	}
+}
+
+func TestApplyReportWeight(t *testing.T) {
+	s := &Server{Config: config.New(t.TempDir())}
+
+	// a reporter a tenth of the way to ReporterUptime needs ten reports to weigh one
+	var record models.NodeReputationRecord
+	var tally models.ReporterTally
+	for i := 0; i < 10; i++ {
+		s.applyReport(&record, &tally, false, 0.1)
+	}
+	if math.Abs(record.Failures-1) > 1e-9 {
+		t.Fatalf("ten reports of weight 0.1 weigh %v failures, want 1", record.Failures)
+	}
+
+	s.applyReport(&record, &tally, false, 0)
+	if math.Abs(record.Failures-1) > 1e-9 {
+		t.Fatalf("a report of weight 0 moved the failures to %v", record.Failures)
+	}
+}
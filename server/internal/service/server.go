@@ -0,0 +1,70 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/FraMan97/kairos/server/internal/config"
+	"github.com/FraMan97/kairos/server/internal/crypto"
+	"github.com/FraMan97/kairos/server/internal/database"
+	"github.com/FraMan97/kairos/server/internal/transport"
+	"github.com/boltdb/bolt"
+)
+
+var buckets = []string{"active_nodes", "manifests", "tombstones", "key_rotations", "reputation"}
+
+// Server is a bootstrap server: its settings, database, keys and the way it reaches the
+// others. Nothing is shared between two servers, so several of them can run in one process.
+type Server struct {
+	Config     *config.Config
+	DB         *bolt.DB
+	Keys       *crypto.KeyStore
+	Transport  transport.Transport
+	HttpClient *http.Client
+	// host advertised to the others: the .onion address with Tor, AdvertiseHost with the loopback transport
+	OnionAddress string
+}
+
+// NewServer opens the database of the server and creates its buckets. The keystore is
+// still locked: set its passphrase and call LoadOrCreateKeyPair before using the server.
+func NewServer(cfg *config.Config, serverTransport transport.Transport) (*Server, error) {
+	db, err := database.OpenDatabase(cfg.DatabaseDir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	for _, bucket := range buckets {
+		err = database.EnsureBucket(db, bucket)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating bucket '%s': %w", bucket, err)
+		}
+	}
+	return &Server{
+		Config:    cfg,
+		DB:        db,
+		Keys:      crypto.NewKeyStore(cfg),
+		Transport: serverTransport,
+	}, nil
+}
+
+func (s *Server) Close() error {
+	return s.DB.Close()
+}
+
+// Address is the address the others reach the server at.
+func (s *Server) Address() string {
+	return s.OnionAddress + ":" + strconv.Itoa(s.Config.Port)
+}
+
+// StartTransport makes the server reachable and sets the advertised address and the http
+// client used to reach the others.
+func (s *Server) StartTransport() (string, error) {
+	addr, err := s.Transport.Start()
+	if err != nil {
+		return "", err
+	}
+	s.OnionAddress = addr
+	s.HttpClient = s.Transport.Client()
+	return addr, nil
+}
@@ -7,23 +7,20 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
-	"strconv"
 	"time"
 
-	"github.com/FraMan97/kairos/server/internal/config"
-	"github.com/FraMan97/kairos/server/internal/crypto"
 	"github.com/FraMan97/kairos/server/internal/database"
 	"github.com/FraMan97/kairos/server/internal/models"
 )
 
-func ServerBootstrapSync(ctx context.Context) {
-	ticker := time.NewTicker(getDelay(config.CronSync))
+func (s *Server) ServerBootstrapSync(ctx context.Context) {
+	ticker := time.NewTicker(getDelay(s.Config.CronSync))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			sync()
+			s.sync()
 
 		case <-ctx.Done():
 			log.Println("[Sync] - Context cancelled, stopping ticker")
@@ -32,32 +29,45 @@ func ServerBootstrapSync(ctx context.Context) {
 	}
 }
 
-func sync() {
-	chosenServer := 0
-	if len(config.BootStrapServers) == 0 {
+func (s *Server) sync() {
+	// skip the server itself: the same list can be given to every server
+	peers := []string{}
+	for _, server := range s.Config.BootStrapServers {
+		if server != s.Address() {
+			peers = append(peers, server)
+		}
+	}
+	if len(peers) == 0 {
 		log.Println("[Sync] - No bootstrap server")
 		return
 	}
-	for {
-		chosenServer = rand.Intn(len(config.BootStrapServers))
-		if config.BootStrapServers[chosenServer] != config.OnionAddress+":"+strconv.Itoa(config.Port) {
-			break
-		}
+	chosenServer := peers[rand.Intn(len(peers))]
+	activeNodes, err := database.GetAllData(s.DB, "active_nodes")
+	if err != nil {
+		log.Println("[Sync] - Error: ", err)
+		return
+	}
+
+	fileManifests, err := database.GetAllData(s.DB, "manifests")
+	if err != nil {
+		log.Println("[Sync] - Error: ", err)
+		return
 	}
-	activeNodes, err := database.GetAllData(config.BoltDB, "active_nodes")
+
+	tombstones, err := database.GetAllData(s.DB, "tombstones")
 	if err != nil {
 		log.Println("[Sync] - Error: ", err)
 		return
 	}
 
-	fileManifests, err := database.GetAllData(config.BoltDB, "manifests")
+	keyRotations, err := database.GetAllData(s.DB, "key_rotations")
 	if err != nil {
 		log.Println("[Sync] - Error: ", err)
 		return
 	}
 
-	dataToExchange := models.SynchronizationRequest{Address: config.OnionAddress + strconv.Itoa(config.Port), PublicKey: config.PublicKey,
-		ActiveNodes: activeNodes, FileManifests: fileManifests}
+	dataToExchange := models.SynchronizationRequest{Address: s.Address(), PublicKey: s.Keys.PublicKey(),
+		ActiveNodes: activeNodes, FileManifests: fileManifests, Tombstones: tombstones, KeyRotations: keyRotations}
 
 	jsonBytes, err := json.Marshal(dataToExchange)
 	if err != nil {
@@ -65,7 +75,7 @@ func sync() {
 		return
 	}
 
-	signature, err := crypto.SignMessage(jsonBytes)
+	signature, err := s.Keys.SignMessage(jsonBytes)
 	if err != nil {
 		log.Println("[Sync] - Error: ", err)
 		return
@@ -78,7 +88,7 @@ func sync() {
 		return
 	}
 	var receivedData models.SynchronizationRequest
-	resp, err := config.HttpClient.Post(fmt.Sprintf("http://%s/synchronize", config.BootStrapServers[chosenServer]),
+	resp, err := s.HttpClient.Post(fmt.Sprintf("http://%s/synchronize", chosenServer),
 		"application/json",
 		bytes.NewBuffer(jsonBytes))
 	if err != nil {
@@ -88,7 +98,7 @@ func sync() {
 	defer resp.Body.Close()
 	if resp.StatusCode == 200 {
 		json.NewDecoder(resp.Body).Decode(&receivedData)
-		ProcessAlignment(dataToExchange, receivedData)
+		s.ProcessAlignment(dataToExchange, receivedData)
 		return
 	} else {
 		log.Println("[Sync] - Error:", resp.Body)
@@ -101,32 +111,82 @@ func getDelay(cron int) time.Duration {
 	return delay
 }
 
-func ProcessAlignment(dbData models.SynchronizationRequest, receivedData models.SynchronizationRequest) {
+func (s *Server) ProcessAlignment(dbData models.SynchronizationRequest, receivedData models.SynchronizationRequest) {
+	// rotations first: the ownership of the received manifests and tombstones depends on them
+	for k := range receivedData.KeyRotations {
+		check, _ := database.ExistsKey(s.DB, "key_rotations", k)
+		if !check {
+			err := s.applyKeyRotationData(receivedData.KeyRotations[k])
+			if err != nil {
+				log.Println("[Sync] - Key rotation discarded: ", err)
+			}
+		}
+	}
+
+	now := time.Now()
 	for k := range receivedData.ActiveNodes {
-		check, _ := database.ExistsKey(config.BoltDB, "active_nodes", k)
-		if check {
-			var current *models.ActiveNodeRecord
-			var received *models.ActiveNodeRecord
-			json.Unmarshal(dbData.ActiveNodes[k], &current)
-			json.Unmarshal(receivedData.ActiveNodes[k], &received)
-
-			if current.Timestamp < received.Timestamp {
-				database.PutData(config.BoltDB, "active_nodes", k, receivedData.ActiveNodes[k])
+		var record models.ActiveNodeRecord
+		if json.Unmarshal(receivedData.ActiveNodes[k], &record) != nil {
+			continue
+		}
+		if record.Timestamp > now.UnixNano() {
+			// a peer clock slightly ahead is tolerated, anything further would keep the node alive
+			if !s.WithinClockSkew(record.Timestamp, now) {
+				log.Printf("[Sync] - Node %s discarded: heartbeat dated in the future\n", k)
+				continue
 			}
+			record.Timestamp = now.UnixNano()
+		}
+		if !s.isAlive(record, now) {
+			continue // don't bring back nodes that already expired here
+		}
+		payload, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		// compare with the record in the DB: the node may have subscribed since the
+		// snapshot sent to the peer was taken
+		var current models.ActiveNodeRecord
+		data, err := database.GetData(s.DB, "active_nodes", k)
+		if err != nil || json.Unmarshal(data, &current) != nil || current.Timestamp < record.Timestamp {
+			database.PutData(s.DB, "active_nodes", k, payload)
+		}
+	}
 
-		} else {
-			database.PutData(config.BoltDB, "active_nodes", k, receivedData.ActiveNodes[k])
+	for k := range receivedData.Tombstones {
+		if !s.IsRevoked(k) {
+			err := s.applyTombstone(receivedData.Tombstones[k])
+			if err != nil {
+				log.Println("[Sync] - Tombstone discarded: ", err)
+			}
 		}
 	}
 
 	for k := range receivedData.FileManifests {
-		check, _ := database.ExistsKey(config.BoltDB, "manifests", k)
-		if !check {
-			var received *models.FileManifest
-			json.Unmarshal(receivedData.FileManifests[k], &received)
-			database.PutData(config.BoltDB, "manifests", k, receivedData.FileManifests[k])
+		var received models.ManifestEnvelope
+		err := json.Unmarshal(receivedData.FileManifests[k], &received)
+		if err != nil || s.IsRevoked(k) {
+			continue
+		}
+		var manifest models.FileManifest
+		err = json.Unmarshal(received.Manifest, &manifest)
+		if err != nil || manifest.FileId != k {
+			continue
+		}
+		check, err := VerifyManifestEnvelope(received)
+		if err != nil || !check {
+			log.Printf("[Sync] - Manifest %s discarded: signature not verified\n", k)
+			continue
+		}
+		err = VerifyManifestPublisher(k, received)
+		if err != nil {
+			log.Printf("[Sync] - Manifest %s discarded: %v\n", k, err)
+			continue
+		}
+		err = s.storeSyncedManifest(k, received, manifest.Version, receivedData.FileManifests[k])
+		if err != nil {
+			log.Printf("[Sync] - Error storing manifest %s: %v\n", k, err)
 		}
-
 	}
 
 }
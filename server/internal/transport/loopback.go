@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Loopback is plain TCP without Tor: the node advertises Host (AdvertiseHost, 127.0.0.1
+// by default) and calls the others directly. It is meant for development
+// and tests on one machine or a trusted local network, it gives no anonymity.
+type Loopback struct {
+	Host string
+}
+
+func (l *Loopback) Start() (string, error) {
+	return l.Host, nil
+}
+
+func (l *Loopback) Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{Proxy: nil}}
+}
+
+func (l *Loopback) Listen(port int) (net.Listener, error) {
+	return net.Listen("tcp", fmt.Sprintf("%s:%d", l.Host, port))
+}
@@ -0,0 +1,239 @@
+package simulation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/FraMan97/kairos/client/peer"
+	"github.com/FraMan97/kairos/server/bootstrap"
+)
+
+const (
+	passphrase = "simulation"
+	serverPort = 3000
+	nodePort   = 8081
+
+	maxStarting = 4
+)
+
+type Options struct {
+	Servers int
+	Nodes   int
+	// TargetChunkSize is kept small so that a file of a few hundred KB spreads over
+	// most of the nodes.
+	TargetChunkSize int
+	Dir             string
+}
+
+// SimNode is a storage node of the simulation with its control API.
+type SimNode struct {
+	Host   string
+	Node   *peer.Node
+	Config *peer.Config
+	wiped  bool
+}
+
+// Cluster is a whole Kairos network in one process: the bootstrap servers, the storage
+// nodes and the in-memory network between them. All the nodes share a local beacon that
+// stands in for Drand.
+type Cluster struct {
+	Network *Network
+	Servers []*bootstrap.Server
+	Nodes   []*SimNode
+
+	timeLock peer.TimeLockProvider
+}
+
+func NewCluster(opts Options) (*Cluster, error) {
+	if opts.Servers < 1 || opts.Nodes < 2 {
+		return nil, fmt.Errorf("the simulation needs at least 1 server and 2 nodes")
+	}
+	c := &Cluster{Network: NewNetwork(), timeLock: peer.NewLocalTimeLock()}
+
+	bootstrapServers := []string{}
+	for i := 0; i < opts.Servers; i++ {
+		bootstrapServers = append(bootstrapServers, fmt.Sprintf("bootstrap%d:%d", i, serverPort))
+	}
+
+	for i := 0; i < opts.Servers; i++ {
+		host := fmt.Sprintf("bootstrap%d", i)
+		cfg := bootstrap.NewConfig(filepath.Join(opts.Dir, host))
+		cfg.Port = serverPort
+		cfg.CronSync = 1
+		cfg.BootStrapServers = bootstrapServers
+		server, err := bootstrap.Start(cfg, passphrase, c.Network.Transport(host))
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("error starting the bootstrap server %d: %w", i, err)
+		}
+		c.Servers = append(c.Servers, server)
+	}
+
+	// sealing a keystore with scrypt is slow and takes a few hundred MB, a few nodes are
+	// started at a time
+	c.Nodes = make([]*SimNode, opts.Nodes)
+	errs := make([]error, opts.Nodes)
+	starting := make(chan struct{}, maxStarting)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Nodes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			starting <- struct{}{}
+			defer func() { <-starting }()
+			c.Nodes[i], errs[i] = c.startNode(fmt.Sprintf("node%d", i), opts, bootstrapServers)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("error starting the node %d: %w", i, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *Cluster) startNode(host string, opts Options, bootstrapServers []string) (*SimNode, error) {
+	cfg := peer.NewConfig(filepath.Join(opts.Dir, host))
+	cfg.Port = nodePort
+	cfg.BootStrapServers = bootstrapServers
+	cfg.TimeLockBackend = "local"
+	if opts.TargetChunkSize > 0 {
+		cfg.TargetChunkSize = opts.TargetChunkSize
+	}
+	cfg.FileGetDestDir = filepath.Join(opts.Dir, host, "Downloads")
+
+	node, err := peer.Start(cfg, passphrase, c.Network.Transport(host), c.timeLock)
+	if err != nil {
+		return nil, err
+	}
+	return &SimNode{Host: host, Node: node, Config: cfg}, nil
+}
+
+// call goes straight to the control API of the node, as the CLI would do.
+func (n *SimNode) call(r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	n.Node.Control().ServeHTTP(rec, r)
+	return rec
+}
+
+// Put uploads data from the node and returns the id of the file.
+func (n *SimNode) Put(name string, data []byte, releaseTime time.Time) (string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	writer.WriteField("release_time", releaseTime.UTC().Format(time.RFC3339))
+	writer.WriteField("allow_immediate", "true")
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/put", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := n.call(r)
+	if rec.Code != http.StatusOK {
+		return "", fmt.Errorf("put answered %d: %s", rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	var response map[string]string
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	if err != nil {
+		return "", err
+	}
+	return response["fileId"], nil
+}
+
+// Get downloads the file on the node and returns the SHA256 of what was reconstructed.
+func (n *SimNode) Get(fileId string) ([32]byte, error) {
+	rec := n.call(httptest.NewRequest(http.MethodGet, "/get?fileId="+url.QueryEscape(fileId), nil))
+	if rec.Code != http.StatusOK {
+		return [32]byte{}, fmt.Errorf("get answered %d: %s", rec.Code, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	var response map[string]string
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	data, err := os.ReadFile(response["filePath"])
+	if err != nil {
+		return [32]byte{}, err
+	}
+	os.Remove(response["filePath"])
+	return sha256.Sum256(data), nil
+}
+
+// Crash takes the node off the network: the chunks it holds can't be reached anymore.
+func (c *Cluster) Crash(n *SimNode) {
+	c.Network.SetDown(n.Host, true)
+}
+
+// Wipe deletes every chunk the node holds while it stays online.
+func (c *Cluster) Wipe(n *SimNode) error {
+	n.wiped = true
+	return n.Node.WipeChunks()
+}
+
+// Revive brings the crashed nodes back. A wiped node stays empty but can hold new chunks.
+func (c *Cluster) Revive() {
+	for _, n := range c.Nodes {
+		c.Network.SetDown(n.Host, false)
+		n.wiped = false
+	}
+}
+
+// holds tells if the node is still able to serve the chunks it received.
+func (c *Cluster) holds(address string) bool {
+	for _, n := range c.Nodes {
+		if n.Node.Address() == address {
+			return !n.wiped && !c.Network.IsDown(n.Host)
+		}
+	}
+	return false
+}
+
+// Recoverable is the expected outcome of a download: every block needs DataShards
+// distinct shards still held by a live node.
+func (c *Cluster) Recoverable(from *SimNode, fileId string) (bool, error) {
+	manifest, err := from.Node.Manifest(fileId)
+	if err != nil {
+		return false, err
+	}
+	for _, block := range manifest.Split {
+		shards := make(map[int]bool)
+		for _, chunk := range block.Chunks {
+			for _, address := range chunk.Nodes {
+				if c.holds(address) {
+					shards[chunk.ShardIndex] = true
+					break
+				}
+			}
+		}
+		if len(shards) < manifest.ReedSolomonConfig.DataShards {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *Cluster) Close() {
+	for _, n := range c.Nodes {
+		if n != nil {
+			n.Node.Stop()
+		}
+	}
+	for _, server := range c.Servers {
+		server.Stop()
+	}
+}
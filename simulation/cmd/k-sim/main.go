@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/FraMan97/kairos/simulation"
+)
+
+func main() {
+	serversPtr := flag.Int("servers", 1, "Number of bootstrap servers")
+	nodesPtr := flag.Int("nodes", 24, "Number of storage nodes")
+	chunkSizePtr := flag.Int("chunk-size", 16*1024, "Target chunk size of the nodes, small so that a file spreads over many nodes")
+	seedPtr := flag.Int64("seed", time.Now().UnixNano(), "Seed of the files and of the failures")
+	verbosePtr := flag.Bool("verbose", false, "Print the logs of the servers and of the nodes")
+	flag.Parse()
+
+	if !*verbosePtr {
+		log.SetOutput(io.Discard)
+	}
+
+	dir, err := os.MkdirTemp("", "kairos-sim-")
+	if err != nil {
+		fmt.Println("Error creating the simulation directory: ", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+
+	fmt.Printf("Starting %d bootstrap server(s) and %d nodes (seed %d)...\n", *serversPtr, *nodesPtr, *seedPtr)
+	cluster, err := simulation.NewCluster(simulation.Options{
+		Servers:         *serversPtr,
+		Nodes:           *nodesPtr,
+		TargetChunkSize: *chunkSizePtr,
+		Dir:             dir,
+	})
+	if err != nil {
+		fmt.Println("Error starting the simulation: ", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	defer cluster.Close()
+
+	rng := rand.New(rand.NewSource(*seedPtr))
+	failed := 0
+	fmt.Printf("%-16s %-8s %-6s %-9s %-10s %-8s %s\n", "SCENARIO", "CRASHED", "WIPED", "EXPECTED", "RECOVERED", "TIME", "RESULT")
+	for _, scenario := range simulation.DefaultScenarios() {
+		result := cluster.Run(scenario, rng)
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+			failed++
+		}
+		if result.Err != nil {
+			status += ": " + result.Err.Error()
+		}
+		fmt.Printf("%-16s %-8d %-6d %-9t %-10t %-8s %s\n", result.Scenario, result.Crashed, result.Wiped, result.Expected, result.Recovered,
+			result.Duration.Round(100*time.Millisecond), status)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d scenario(s) failed\n", failed)
+		cluster.Close()
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+}
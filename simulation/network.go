@@ -0,0 +1,156 @@
+package simulation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Network connects the simulated nodes in memory. A host that is down refuses every
+// connection, to it and from it, and loses the ones it had open.
+type Network struct {
+	mu        sync.Mutex
+	listeners map[string]*memListener
+	conns     map[string][]net.Conn
+	down      map[string]bool
+}
+
+func NewNetwork() *Network {
+	return &Network{
+		listeners: make(map[string]*memListener),
+		conns:     make(map[string][]net.Conn),
+		down:      make(map[string]bool),
+	}
+}
+
+// Transport returns the transport of the host: it satisfies the transport of both the
+// client and the bootstrap server.
+func (nw *Network) Transport(host string) *MemTransport {
+	return &MemTransport{network: nw, host: host}
+}
+
+func (nw *Network) SetDown(host string, down bool) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if !down {
+		delete(nw.down, host)
+		return
+	}
+	nw.down[host] = true
+	for _, conn := range nw.conns[host] {
+		conn.Close()
+	}
+	delete(nw.conns, host)
+}
+
+func (nw *Network) IsDown(host string) bool {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.down[host]
+}
+
+func (nw *Network) dial(ctx context.Context, from string, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	nw.mu.Lock()
+	listener, ok := nw.listeners[address]
+	if !ok || nw.down[host] || nw.down[from] {
+		nw.mu.Unlock()
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	}
+	client, server := net.Pipe()
+	nw.conns[from] = append(nw.conns[from], client)
+	nw.conns[host] = append(nw.conns[host], server)
+	nw.mu.Unlock()
+
+	select {
+	case listener.accept <- server:
+		return client, nil
+	case <-listener.done:
+		client.Close()
+		return nil, fmt.Errorf("dial %s: connection refused", address)
+	case <-ctx.Done():
+		client.Close()
+		return nil, ctx.Err()
+	}
+}
+
+func (nw *Network) listen(address string) (net.Listener, error) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if _, ok := nw.listeners[address]; ok {
+		return nil, fmt.Errorf("listen %s: address already in use", address)
+	}
+	listener := &memListener{network: nw, address: address, accept: make(chan net.Conn), done: make(chan struct{})}
+	nw.listeners[address] = listener
+	return listener, nil
+}
+
+type memListener struct {
+	network *Network
+	address string
+	accept  chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.once.Do(func() {
+		l.network.mu.Lock()
+		delete(l.network.listeners, l.address)
+		l.network.mu.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr(l.address)
+}
+
+type memAddr string
+
+func (a memAddr) Network() string {
+	return "memory"
+}
+
+func (a memAddr) String() string {
+	return string(a)
+}
+
+// MemTransport is the transport of a simulated host: it advertises the host name and
+// every connection goes through the in-memory network.
+type MemTransport struct {
+	network *Network
+	host    string
+}
+
+func (t *MemTransport) Start() (string, error) {
+	return t.host, nil
+}
+
+func (t *MemTransport) Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _ string, address string) (net.Conn, error) {
+			return t.network.dial(ctx, t.host, address)
+		},
+	}}
+}
+
+func (t *MemTransport) Listen(port int) (net.Listener, error) {
+	return t.network.listen(net.JoinHostPort(t.host, strconv.Itoa(port)))
+}
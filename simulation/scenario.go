@@ -0,0 +1,115 @@
+package simulation
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Scenario uploads a file from the first node, breaks part of the network and downloads
+// the file from the second node. The uploader and the downloader never fail.
+type Scenario struct {
+	Name     string
+	FileSize int
+	// Crash and Wipe are the share of the other nodes taken offline and losing their
+	// chunks, between the upload and the download.
+	Crash float64
+	Wipe  float64
+	// ReleaseIn time-locks the file: the download is tried once before the release, when
+	// it must fail, and once after.
+	ReleaseIn time.Duration
+}
+
+func DefaultScenarios() []Scenario {
+	return []Scenario{
+		{Name: "healthy", FileSize: 256 * 1024},
+		{Name: "node-crashes", FileSize: 256 * 1024, Crash: 0.3},
+		{Name: "data-loss", FileSize: 256 * 1024, Wipe: 0.3},
+		{Name: "mixed-failures", FileSize: 512 * 1024, Crash: 0.2, Wipe: 0.2},
+		{Name: "massive-failure", FileSize: 256 * 1024, Crash: 0.8},
+		{Name: "time-lock", FileSize: 64 * 1024, ReleaseIn: 8 * time.Second},
+	}
+}
+
+type Result struct {
+	Scenario  string
+	Crashed   int
+	Wiped     int
+	Expected  bool
+	Recovered bool
+	Duration  time.Duration
+	Err       error
+}
+
+// Passed tells if the download ended as the placement of the chunks predicted: a file is
+// expected back as long as every block keeps enough shards on live nodes.
+func (r Result) Passed() bool {
+	return r.Err == nil && r.Expected == r.Recovered
+}
+
+func (c *Cluster) Run(s Scenario, rng *rand.Rand) Result {
+	start := time.Now()
+	result := Result{Scenario: s.Name}
+	defer c.Revive()
+
+	uploader, downloader := c.Nodes[0], c.Nodes[1]
+	data := make([]byte, s.FileSize)
+	rng.Read(data)
+	releaseTime := time.Now().Add(s.ReleaseIn)
+
+	fileId, err := uploader.Put(s.Name+".bin", data, releaseTime)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if len(c.Servers) > 1 {
+		// the manifest reached one server, the others get it at the next synchronization
+		time.Sleep(3 * time.Second)
+	}
+
+	others := append([]*SimNode{}, c.Nodes[2:]...)
+	rng.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	result.Crashed = int(s.Crash * float64(len(others)))
+	result.Wiped = int(s.Wipe * float64(len(others)))
+	if result.Crashed+result.Wiped > len(others) {
+		result.Wiped = len(others) - result.Crashed
+	}
+	for _, n := range others[:result.Crashed] {
+		c.Crash(n)
+	}
+	for _, n := range others[result.Crashed : result.Crashed+result.Wiped] {
+		err = c.Wipe(n)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	result.Expected, err = c.Recoverable(downloader, fileId)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if s.ReleaseIn > 0 {
+		if _, err := downloader.Get(fileId); err == nil {
+			result.Err = fmt.Errorf("the file was downloaded before its release time")
+			return result
+		}
+		// the beacon publishes the round of the release a few seconds after it
+		time.Sleep(time.Until(releaseTime) + 4*time.Second)
+	}
+
+	hash, err := downloader.Get(fileId)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result
+	}
+	if hash != sha256.Sum256(data) {
+		result.Err = fmt.Errorf("the reconstructed file is different from the original")
+		return result
+	}
+	result.Recovered = true
+	return result
+}
@@ -0,0 +1,227 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestCluster(t *testing.T, servers int, nodes int) *Cluster {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("the simulation starts a whole network")
+	}
+	cluster, err := NewCluster(Options{Servers: servers, Nodes: nodes, TargetChunkSize: 16 * 1024, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func TestPutGetWithNodeFailures(t *testing.T) {
+	cluster := newTestCluster(t, 1, 12)
+	rng := rand.New(rand.NewSource(1))
+	for _, scenario := range DefaultScenarios() {
+		t.Run(scenario.Name, func(t *testing.T) {
+			result := cluster.Run(scenario, rng)
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if !result.Passed() {
+				t.Fatalf("%d crashed and %d wiped nodes: recovered %t, expected %t", result.Crashed, result.Wiped, result.Recovered, result.Expected)
+			}
+		})
+	}
+}
+
+func TestPutGetAcrossServers(t *testing.T) {
+	cluster := newTestCluster(t, 2, 8)
+	rng := rand.New(rand.NewSource(2))
+	result := cluster.Run(Scenario{Name: "synchronized", FileSize: 128 * 1024, Crash: 0.2}, rng)
+	if !result.Passed() {
+		t.Fatalf("recovered %t, expected %t: %v", result.Recovered, result.Expected, result.Err)
+	}
+}
+
+// The chunks uploaded before a rotation stay bound to the old key: the owner must still
+// read them before the release and delete them.
+func TestOwnerRequestsAfterKeyRotation(t *testing.T) {
+	cluster := newTestCluster(t, 1, 6)
+	owner := cluster.Nodes[0]
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	fileId, err := owner.Put("rotation.bin", data, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = owner.Node.RotateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second rotation right away keeps both retired keys
+	err = owner.Node.RotateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := owner.Node.PublicKeys(); len(keys) != 3 {
+		t.Fatalf("%d keys after two rotations, expected the current one and 2 retired", len(keys))
+	}
+
+	manifest, err := owner.Node.Manifest(fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the manifest republished by the new key is still bound to the FileId through the rotation
+	err = owner.Node.PublishManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cluster.Nodes[1].Node.Manifest(fileId)
+	if err != nil {
+		t.Fatalf("manifest republished after the rotation refused: %v", err)
+	}
+
+	chunk := manifest.Split[0].Chunks[0]
+	err = owner.Node.RequestChunk(context.Background(), chunk.Nodes[0], chunk.ChunkId)
+	if err != nil {
+		t.Fatalf("owner download refused after the rotation: %v", err)
+	}
+
+	placed := map[string][]string{chunk.ChunkId: chunk.Nodes}
+	owner.Node.DeleteChunks(manifest, placed)
+	for _, n := range cluster.Nodes {
+		if slices.Contains(chunk.Nodes, n.Node.Address()) {
+			if _, err := n.Node.Shard(chunk.ChunkId); err == nil {
+				t.Fatalf("chunk %s still on %s after the deletion", chunk.ChunkId, n.Host)
+			}
+		}
+	}
+}
+
+// A holder answering with a corrupted shard must not poison the shards the repair
+// rebuilds and pushes to fresh nodes.
+func TestRepairDropsCorruptedShards(t *testing.T) {
+	cluster := newTestCluster(t, 1, 8)
+	owner := cluster.Nodes[0]
+	data := make([]byte, 16*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	fileId, err := owner.Put("repair.bin", data, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracked, err := owner.Node.TrackedFile(fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holders := func(address string) *SimNode {
+		for _, n := range cluster.Nodes {
+			if n.Node.Address() == address {
+				return n
+			}
+		}
+		t.Fatalf("no node at %s", address)
+		return nil
+	}
+	// the first shard is lost everywhere, the second one is corrupted on all its holders
+	block := tracked.Manifest.Split[0]
+	lost, corrupted := block.Chunks[0], block.Chunks[1]
+	for _, address := range lost.Nodes {
+		if err := holders(address).Node.DeleteChunk(lost.ChunkId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, address := range slices.Compact(slices.Sorted(slices.Values(corrupted.Nodes))) {
+		holder := holders(address).Node
+		shard, err := holder.Shard(corrupted.ChunkId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shard[0] ^= 0xff
+		if err := holder.ReplaceShard(corrupted.ChunkId, shard); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the samples of the corrupted chunk are used up, repair draws new ones
+	if err := owner.Node.UseStorageSamples(fileId, corrupted.ChunkId); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := owner.Node.RepairFile(context.Background(), tracked); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := owner.Node.StorageSamples(fileId, corrupted.ChunkId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples != owner.Config.ChallengeSamples {
+		t.Fatalf("%d storage samples after repair, expected %d", samples, owner.Config.ChallengeSamples)
+	}
+	repaired := tracked.Manifest.Split[0].Chunks[lost.ShardIndex]
+	if len(repaired.Nodes) == 0 {
+		t.Fatal("the lost shard was not placed again")
+	}
+	for _, address := range repaired.Nodes {
+		shard, err := holders(address).Node.Shard(repaired.ChunkId)
+		if err != nil {
+			t.Fatalf("rebuilt chunk missing on %s: %v", address, err)
+		}
+		hash := sha256.Sum256(shard)
+		if !bytes.Equal(hash[:], tracked.Blocks[0].ShardHashes[lost.ShardIndex]) {
+			t.Fatalf("rebuilt shard on %s differs from the uploaded one", address)
+		}
+	}
+}
+
+// The file name comes from the manifest: a publisher can't make a download land outside
+// the download folder.
+func TestGetKeepsFilesInTheDownloadFolder(t *testing.T) {
+	cluster := newTestCluster(t, 1, 6)
+	owner, downloader := cluster.Nodes[0], cluster.Nodes[1]
+	data := make([]byte, 16*1024)
+	rand.New(rand.NewSource(5)).Read(data)
+	fileId, err := owner.Put("escape.bin", data, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := owner.Node.Manifest(fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.FileName = "../escape.bin"
+	err = owner.Node.PublishManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outside := filepath.Join(filepath.Dir(downloader.Config.FileGetDestDir), "escape.bin")
+	if err := os.WriteFile(outside, []byte("untouched"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := downloader.Get(fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != sha256.Sum256(data) {
+		t.Fatal("the downloaded file differs from the uploaded one")
+	}
+	if stored, err := os.ReadFile(outside); err != nil || string(stored) != "untouched" {
+		t.Fatalf("the download was written to %s", outside)
+	}
+}